@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// Roles, from least to most privileged
+const (
+	RoleViewer   = "viewer"   // Read-only access
+	RoleOperator = "operator" // Config changes, reloads, Kubernetes sync
+	RoleAdmin    = "admin"    // Deletes, Kubernetes cleanup, API token management
+)
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ErrInvalidToken is returned (possibly wrapped) for missing, unknown or expired credentials
+var ErrInvalidToken = errors.New("invalid token")
+
+// Principal is an authenticated API caller
+type Principal struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Method string `json:"method"` // token, jwt, device
+}
+
+// Allows reports whether the principal has at least the given role
+func (p *Principal) Allows(role string) bool {
+	return roleRank[p.Role] >= roleRank[role]
+}
+
+// Authenticator authenticates the bearer token of a request
+// It returns (nil, nil) for tokens of a kind it does not handle, so that the
+// next authenticator is tried, and an error wrapping ErrInvalidToken for
+// tokens it handles but rejects.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+var (
+	enabled        bool
+	authenticators []Authenticator
+)
+
+// Enable turns on authentication of protected routes with the given authenticators,
+// tried in order. Without Enable every route is open.
+func Enable(list ...Authenticator) {
+	enabled = true
+	authenticators = list
+}
+
+// Enabled reports whether authentication is enabled
+func Enabled() bool {
+	return enabled
+}
+
+// ValidRole checks if a role name is known
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HigherRole returns the more privileged of two roles (unknown roles rank lowest)
+func HigherRole(a, b string) string {
+	if roleRank[b] > roleRank[a] {
+		return b
+	}
+	return a
+}
+
+// authenticate runs the authenticators on a bearer token
+func authenticate(ctx context.Context, token string) (*Principal, error) {
+	for _, a := range authenticators {
+		principal, err := a.Authenticate(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if principal != nil {
+			return principal, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
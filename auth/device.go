@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deviceTokenPrefix marks device tokens, so they are never mistaken for API tokens
+const deviceTokenPrefix = "emd_"
+
+// signingKeyContext is the message the signing key is derived from a device token with
+const signingKeyContext = "edge-metrics-signing"
+
+var deviceAuthRequired = true
+
+// SetDeviceAuthRequired sets whether exporter-facing routes reject requests
+// without a device token (the default). Devices that were never issued a token
+// (registered before device tokens existed) are let through either way until
+// one is issued. When false, requests without a token may also read the config
+// of devices that have a token, so that exporters can be given their tokens one
+// by one; a token that is sent is still checked, and devices that were issued a
+// token must send it on requests that change state.
+func SetDeviceAuthRequired(required bool) {
+	deviceAuthRequired = required
+}
+
+// DeviceAuthRequired reports whether exporter-facing routes require a device token
+func DeviceAuthRequired() bool {
+	return deviceAuthRequired
+}
+
+// IssueDeviceCredential generates a new token for a device, replacing its
+// previous one (which stops working right away). The token is only returned
+// in the Token field of the credential; the server keeps its hash.
+func IssueDeviceCredential(deviceID string) (*models.DeviceCredential, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate device token: %w", err)
+	}
+
+	token := deviceTokenPrefix + hex.EncodeToString(buf)
+	credential := &models.DeviceCredential{
+		DeviceID:   deviceID,
+		Token:      token,
+		TokenHash:  HashToken(token),
+		SigningKey: SigningKey(token),
+		Prefix:     token[:len(deviceTokenPrefix)+8],
+	}
+	if err := repository.SaveDeviceCredential(credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// VerifyDeviceToken checks a token against the credential of a device
+// Returns false if the token does not match or no credential was issued.
+func VerifyDeviceToken(deviceID, token string) (bool, error) {
+	credential, err := repository.GetDeviceCredential(deviceID)
+	if err != nil {
+		return false, err
+	}
+	if credential == nil || subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(credential.TokenHash)) != 1 {
+		return false, nil
+	}
+
+	if err := repository.TouchDeviceCredential(deviceID, time.Now()); err != nil {
+		log.Printf("Error recording use of device credential %s: %v", deviceID, err)
+	}
+	return true, nil
+}
+
+// SigningKey derives the key requests to the exporter of a device are signed with
+// from its token: hex(HMAC-SHA256(token, "edge-metrics-signing")). Exporters derive
+// it the same way, so the server does not need to keep the token.
+func SigningKey(token string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(signingKeyContext))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeviceToken returns the bearer token of a request, if any
+func DeviceToken(c *gin.Context) (string, bool) {
+	return bearerToken(c.GetHeader("Authorization"))
+}
+
+// RequireDevice returns middleware for exporter-facing routes with a :device_id
+// parameter. The request must carry the token of that device, or, when API
+// authentication is enabled, an API token or JWT of a viewer or higher.
+// Requests without a token are let through if the device was never issued a
+// token, and for reads (GET) also while device authentication is not required.
+func RequireDevice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("device_id")
+		token, ok := DeviceToken(c)
+		if !ok {
+			if !deviceAuthRequired && c.Request.Method == http.MethodGet {
+				c.Next()
+				return
+			}
+			credential, err := repository.GetDeviceCredential(deviceID)
+			if err != nil {
+				log.Printf("Error fetching credential of %s: %v", deviceID, err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
+					Error:   "Internal server error",
+					Message: "Failed to authenticate request",
+				})
+				return
+			}
+			// Exporters deployed before device tokens existed keep working until
+			// their device is issued a token
+			if credential == nil {
+				c.Next()
+				return
+			}
+			abortUnauthorized(c, "Missing device token")
+			return
+		}
+
+		valid, err := VerifyDeviceToken(deviceID, token)
+		if err != nil {
+			log.Printf("Error verifying device token of %s: %v", deviceID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to authenticate request",
+			})
+			return
+		}
+		if valid {
+			c.Set(principalKey, &Principal{Name: deviceID, Method: "device"})
+			c.Next()
+			return
+		}
+
+		// Operators may read device config with their own credentials
+		if enabled {
+			if principal, err := authenticate(c.Request.Context(), token); err == nil && principal.Allows(RoleViewer) {
+				c.Set(principalKey, principal)
+				c.Next()
+				return
+			}
+		}
+
+		log.Printf("Rejected %s %s: invalid device token", c.Request.Method, c.Request.URL.Path)
+		abortUnauthorized(c, "Invalid device token")
+	}
+}
@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 for RS256/ES256
+	_ "crypto/sha512" // SHA-384/512 for RS384/RS512/ES384
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWT validation timing (clock skew allowance, minimum time between JWKS refreshes)
+const (
+	jwtLeeway       = time.Minute
+	jwksMinRefresh  = time.Minute
+	jwksHTTPTimeout = 10 * time.Second
+)
+
+// JWTConfig configures OIDC/JWT bearer token validation
+type JWTConfig struct {
+	IssuerURL     string // Expected iss; also used to discover the JWKS URL
+	Audience      string // Expected aud (not checked if empty)
+	JWKSURL       string // Signing keys (discovered from the issuer if empty)
+	RoleClaim     string // Claim holding the role(s), dotted for nested claims (e.g. realm_access.roles)
+	UsernameClaim string // Claim used as principal name
+}
+
+// JWTAuthenticator validates JWT bearer tokens signed with RS256/384/512 or
+// ES256/384 keys published as a JWKS (e.g. by an OIDC provider)
+type JWTAuthenticator struct {
+	config JWTConfig
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewJWTAuthenticator creates a JWT authenticator
+// Signing keys are fetched on first use and refreshed when an unknown key ID is seen.
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	if config.IssuerURL == "" && config.JWKSURL == "" {
+		return nil, fmt.Errorf("an issuer URL or JWKS URL is required")
+	}
+	if config.RoleClaim == "" {
+		config.RoleClaim = "roles"
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "sub"
+	}
+	return &JWTAuthenticator{config: config}, nil
+}
+
+// Authenticate validates a JWT and maps its role claim to a role
+// The most privileged known role wins; tokens without one are rejected.
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil // Not a JWT
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT header", ErrInvalidToken)
+	}
+
+	key, err := a.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: unknown JWT signing key %q", ErrInvalidToken, header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT signature", ErrInvalidToken)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT claims", ErrInvalidToken)
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	role := ""
+	switch value := claimValue(claims, a.config.RoleClaim).(type) {
+	case string:
+		if ValidRole(value) {
+			role = value
+		}
+	case []interface{}:
+		for _, item := range value {
+			if name, ok := item.(string); ok && ValidRole(name) {
+				role = HigherRole(role, name)
+			}
+		}
+	}
+	if role == "" {
+		return nil, fmt.Errorf("%w: JWT has no known role in claim %s", ErrInvalidToken, a.config.RoleClaim)
+	}
+
+	name, _ := claimValue(claims, a.config.UsernameClaim).(string)
+	if name == "" {
+		name, _ = claims["sub"].(string)
+	}
+
+	return &Principal{Name: name, Role: role, Method: "jwt"}, nil
+}
+
+// checkClaims validates the time, issuer and audience claims
+func (a *JWTAuthenticator) checkClaims(claims map[string]interface{}) error {
+	now := time.Now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("JWT has no exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return fmt.Errorf("JWT expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("JWT not valid yet")
+	}
+
+	if a.config.IssuerURL != "" && claims["iss"] != a.config.IssuerURL {
+		return fmt.Errorf("unexpected JWT issuer %v", claims["iss"])
+	}
+
+	if a.config.Audience != "" {
+		matched := false
+		switch aud := claims["aud"].(type) {
+		case string:
+			matched = aud == a.config.Audience
+		case []interface{}:
+			for _, item := range aud {
+				if item == a.config.Audience {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return fmt.Errorf("JWT audience does not include %s", a.config.Audience)
+		}
+	}
+
+	return nil
+}
+
+// key returns the signing key with the given ID (the only key if kid is empty),
+// refreshing the JWKS if the key is unknown. Returns nil if there is no such key.
+func (a *JWTAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if key := a.lookup(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(a.fetchedAt) < jwksMinRefresh {
+		return nil, nil
+	}
+
+	keys, err := a.fetchKeys(ctx)
+	a.fetchedAt = time.Now()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	a.keys = keys
+
+	return a.lookup(kid), nil
+}
+
+// lookup finds a cached signing key (mu must be held)
+func (a *JWTAuthenticator) lookup(kid string) crypto.PublicKey {
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key
+		}
+	}
+	return a.keys[kid]
+}
+
+// fetchKeys downloads and parses the JWKS, discovering its URL from the issuer if needed
+func (a *JWTAuthenticator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	jwksURL := a.config.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		discoveryURL := strings.TrimSuffix(a.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+		if err := getJSON(ctx, discoveryURL, &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, fmt.Errorf("no jwks_uri in %s", discoveryURL)
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURL, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := decodeBigInt(jwk.N)
+			e, errE := decodeBigInt(jwk.E)
+			if errN != nil || errE != nil || !e.IsInt64() {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, errX := decodeBigInt(jwk.X)
+			y, errY := decodeBigInt(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+
+	return keys, nil
+}
+
+// verifySignature checks a JWT signature
+// Only asymmetric algorithms are accepted (never "none" or HMAC)
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported JWT algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("JWT algorithm %s does not match an RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+			return fmt.Errorf("invalid JWT signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("JWT algorithm %s does not match an EC key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("invalid JWT signature")
+		}
+	default:
+		return fmt.Errorf("unsupported JWT signing key")
+	}
+
+	return nil
+}
+
+// claimValue returns a claim by its dotted path (e.g. realm_access.roles)
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// decodeSegment decodes a base64url JWT segment as JSON
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeBigInt decodes a base64url JWK integer
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// getJSON fetches a JSON document
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: jwksHTTPTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"edge-metrics-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey is the gin context key of the authenticated principal
+const principalKey = "auth.principal"
+
+// Require returns middleware that only lets requests through whose bearer token
+// (Authorization: Bearer <token>) authenticates a principal with at least the
+// given role. Does nothing while authentication is disabled.
+func Require(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			abortUnauthorized(c, "Missing bearer token")
+			return
+		}
+
+		principal, err := authenticate(c.Request.Context(), token)
+		if err != nil {
+			if errors.Is(err, ErrInvalidToken) {
+				log.Printf("Rejected %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+				abortUnauthorized(c, "Invalid or expired token")
+				return
+			}
+			log.Printf("Error authenticating %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to authenticate request",
+			})
+			return
+		}
+
+		if !principal.Allows(role) {
+			log.Printf("Denied %s %s to %s (role %s, requires %s)",
+				c.Request.Method, c.Request.URL.Path, principal.Name, principal.Role, role)
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "forbidden",
+				Message: fmt.Sprintf("Role %q is not allowed to do this, requires %s", principal.Role, role),
+			})
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// FromContext returns the authenticated principal of a request
+// Returns nil if authentication is disabled or the route is public
+func FromContext(c *gin.Context) *Principal {
+	if value, ok := c.Get(principalKey); ok {
+		if principal, ok := value.(*Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer <token>" header
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// abortUnauthorized writes a 401 response with a Bearer challenge
+func abortUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="edge-metrics-server"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+		Error:   "unauthorized",
+		Message: message,
+	})
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+)
+
+// tokenPrefix marks static API tokens, so they are never mistaken for JWTs
+const tokenPrefix = "ems_"
+
+// GenerateToken returns a new random API token, its SHA-256 hash (the only
+// form that is stored) and its display prefix
+func GenerateToken() (token, hash, prefix string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	token = tokenPrefix + hex.EncodeToString(buf)
+	return token, HashToken(token), token[:len(tokenPrefix)+8], nil
+}
+
+// HashToken returns the SHA-256 hash of an API or device token (hex)
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenAuthenticator authenticates static API tokens stored hashed in SQLite
+type TokenAuthenticator struct{}
+
+// Authenticate looks up an API token by its hash
+func (TokenAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, nil
+	}
+
+	record, err := repository.GetAPITokenByHash(HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("%w: unknown API token", ErrInvalidToken)
+	}
+
+	now := time.Now()
+	if record.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, record.ExpiresAt)
+		if err == nil && !now.Before(expiresAt) {
+			return nil, fmt.Errorf("%w: API token %s expired", ErrInvalidToken, record.Name)
+		}
+	}
+
+	if err := repository.TouchAPIToken(record.ID, now); err != nil {
+		log.Printf("Error recording use of API token %s: %v", record.Name, err)
+	}
+
+	return &Principal{Name: record.Name, Role: record.Role, Method: "token"}, nil
+}
+
+// Bootstrap creates an admin API token named "bootstrap" if no API token exists yet,
+// so that the first tokens can be created through the API.
+// Returns the new token, or "" if tokens already exist.
+func Bootstrap() (string, error) {
+	count, err := repository.CountAPITokens()
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "", nil
+	}
+
+	token, hash, prefix, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	record := models.APIToken{
+		Name:      "bootstrap",
+		Role:      RoleAdmin,
+		TokenHash: hash,
+		Prefix:    prefix,
+	}
+	if err := repository.CreateAPIToken(&record, nil); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,134 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// metricListSuffix is the key suffix used in edge-metric-list.json (e.g. "jetson_orin_metrics")
+const metricListSuffix = "_metrics"
+
+// catalog maps device_type -> metric name -> enabled by default
+var catalog map[string]map[string]bool
+
+// DeviceTypeCatalog represents the known metrics for a single device type
+type DeviceTypeCatalog struct {
+	DeviceType     string   `json:"device_type"`
+	Metrics        []string `json:"metrics"`
+	DefaultEnabled []string `json:"default_enabled"`
+	Total          int      `json:"total"`
+}
+
+// Load reads the metric catalog from an edge-metric-list.json file
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read metric catalog: %w", err)
+	}
+
+	var raw map[string]map[string]bool
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("failed to parse metric catalog: %w", err)
+	}
+
+	loaded := make(map[string]map[string]bool)
+	for key, metrics := range raw {
+		deviceType := strings.TrimSuffix(key, metricListSuffix)
+		loaded[deviceType] = metrics
+	}
+
+	catalog = loaded
+	return nil
+}
+
+// IsLoaded checks if the metric catalog has been loaded
+func IsLoaded() bool {
+	return catalog != nil
+}
+
+// DeviceTypes returns all device types present in the catalog
+func DeviceTypes() []string {
+	types := make([]string, 0, len(catalog))
+	for deviceType := range catalog {
+		types = append(types, deviceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Get returns the catalog entry for a device type
+func Get(deviceType string) (*DeviceTypeCatalog, bool) {
+	metrics, ok := catalog[deviceType]
+	if !ok {
+		return nil, false
+	}
+
+	entry := &DeviceTypeCatalog{
+		DeviceType:     deviceType,
+		Metrics:        []string{},
+		DefaultEnabled: []string{},
+		Total:          len(metrics),
+	}
+	for name, enabled := range metrics {
+		entry.Metrics = append(entry.Metrics, name)
+		if enabled {
+			entry.DefaultEnabled = append(entry.DefaultEnabled, name)
+		}
+	}
+	sort.Strings(entry.Metrics)
+	sort.Strings(entry.DefaultEnabled)
+
+	return entry, true
+}
+
+// UnknownMetrics returns the metrics that are not known for a device.
+// Metrics are checked against the device_type entry plus any catalog entry
+// matching an extra config block (e.g. a jetson_orin with a "shelly" block
+// may also enable shelly_* metrics).
+// Device types that are not in the catalog are not validated.
+func UnknownMetrics(deviceType string, extraBlocks []string, metrics []string) []string {
+	if _, ok := catalog[deviceType]; !ok {
+		return nil
+	}
+
+	known := make(map[string]bool)
+	for _, key := range append([]string{deviceType}, extraBlocks...) {
+		for name := range catalog[key] {
+			known[name] = true
+		}
+	}
+
+	var unknown []string
+	for _, m := range metrics {
+		if !known[m] {
+			unknown = append(unknown, m)
+		}
+	}
+	return unknown
+}
+
+// UnknownMetricsAnyType returns the metrics that no device type of the catalog knows
+// Used for configs that are not bound to a device type (profiles).
+func UnknownMetricsAnyType(metrics []string) []string {
+	if catalog == nil {
+		return nil
+	}
+
+	var unknown []string
+	for _, m := range metrics {
+		known := false
+		for _, names := range catalog {
+			if _, ok := names[m]; ok {
+				known = true
+				break
+			}
+		}
+		if !known {
+			unknown = append(unknown, m)
+		}
+	}
+	return unknown
+}
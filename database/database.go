@@ -55,6 +55,255 @@ func createTables() error {
 	// Add ip_address column if it doesn't exist (for existing databases)
 	_, _ = DB.Exec("ALTER TABLE devices ADD COLUMN ip_address TEXT")
 
+	// Add approval_status column if it doesn't exist (pending, approved, rejected)
+	_, _ = DB.Exec("ALTER TABLE devices ADD COLUMN approval_status TEXT DEFAULT 'approved'")
+
+	// Add version column if it doesn't exist (optimistic concurrency, incremented on every change)
+	_, _ = DB.Exec("ALTER TABLE devices ADD COLUMN version INTEGER NOT NULL DEFAULT 1")
+
+	// Last version of deleted devices, so that a recreated device continues from it
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS device_tombstones (
+		device_id TEXT PRIMARY KEY,
+		version INTEGER NOT NULL,
+		deleted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Config revision history (one row per saved DeviceConfig)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS config_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id TEXT NOT NULL,
+		revision INTEGER NOT NULL,
+		device_type TEXT NOT NULL,
+		port INTEGER,
+		reload_port INTEGER,
+		enabled_metrics TEXT,
+		extra_config TEXT,
+		ip_address TEXT,
+		source TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (device_id, revision)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Cached device health (written by the background health poller)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS device_health (
+		device_id TEXT PRIMARY KEY,
+		status TEXT NOT NULL,
+		last_seen DATETIME,
+		last_checked DATETIME,
+		last_error TEXT,
+		consecutive_failures INTEGER DEFAULT 0
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Add latency_ms column if it doesn't exist (for existing databases)
+	_, _ = DB.Exec("ALTER TABLE device_health ADD COLUMN latency_ms INTEGER")
+
+	// Device event log (IP changes, endpoint refreshes)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS device_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		old_value TEXT,
+		new_value TEXT,
+		source TEXT,
+		message TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_device_events_device_id ON device_events (device_id, id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Prometheus scrape settings per device type
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS scrape_settings (
+		device_type TEXT PRIMARY KEY,
+		interval TEXT NOT NULL,
+		scrape_timeout TEXT,
+		metrics_path TEXT NOT NULL DEFAULT '/metrics',
+		relabelings TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Device labels (key/value pairs used by label selectors)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS device_labels (
+		device_id TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (device_id, key)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Config profiles and their assignment to devices (position orders the profiles of a device)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS profiles (
+		name TEXT PRIMARY KEY,
+		description TEXT,
+		config TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS device_profiles (
+		device_id TEXT NOT NULL,
+		profile_name TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (device_id, profile_name)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Per-device_type defaults for new devices (seeded from the metric catalog)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS device_templates (
+		device_type TEXT PRIMARY KEY,
+		port INTEGER,
+		reload_port INTEGER,
+		enabled_metrics TEXT,
+		extra_config TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Device types already seeded from the metric catalog (deleted templates stay deleted)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS template_seeds (
+		device_type TEXT PRIMARY KEY,
+		seeded_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// JSON Schemas for extra config blocks per device type
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS config_schemas (
+		device_type TEXT NOT NULL,
+		block TEXT NOT NULL,
+		schema TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (device_type, block)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Reload outbox (one pending job per device, retried with backoff)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS reload_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id TEXT NOT NULL,
+		version INTEGER,
+		reason TEXT,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		coalesced INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_attempt_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivered_at DATETIME
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_reload_jobs_pending ON reload_jobs (device_id) WHERE status = 'pending';
+	CREATE INDEX IF NOT EXISTS idx_reload_jobs_device_id ON reload_jobs (device_id, id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Secret extra config paths (values encrypted at rest, redacted in responses)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS secret_paths (
+		path TEXT PRIMARY KEY,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Device credentials (per-device tokens for exporter requests and reload signatures)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS device_credentials (
+		device_id TEXT PRIMARY KEY,
+		token_hash TEXT NOT NULL,
+		signing_key TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// API tokens (SHA-256 hashes, never the tokens themselves)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		role TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME,
+		last_used_at DATETIME
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Running config comparison results (drift detection)
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS device_sync_state (
+		device_id TEXT PRIMARY KEY,
+		status TEXT NOT NULL,
+		config_version INTEGER,
+		applied_revision INTEGER,
+		diff TEXT,
+		error TEXT,
+		checked_at DATETIME,
+		synced_at DATETIME
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,115 @@
+package discovery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"edge-metrics-server/health"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+)
+
+// TargetGroup represents a Prometheus http_sd_config / file_sd_config target group
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// Filter selects the devices returned as targets
+// Empty fields match every device
+type Filter struct {
+	DeviceTypes []string // device_type values
+	Statuses    []string // health statuses (healthy, unhealthy, unreachable, unknown)
+}
+
+// Targets returns one target group per approved device with an IP address
+// Pending and rejected devices are never returned. Each group is labelled with
+// the device labels, device_id and device_type, plus the scrape settings of the
+// device type (__metrics_path__, __scrape_interval__, __scrape_timeout__) when configured.
+func Targets(filter Filter) ([]TargetGroup, error) {
+	devices, err := health.NewDeviceSource().ListDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+
+	settings, err := repository.GetAllScrapeSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scrape settings: %w", err)
+	}
+	settingsMap := make(map[string]models.ScrapeSettings)
+	for _, s := range settings {
+		settingsMap[s.DeviceType] = s
+	}
+
+	groups := []TargetGroup{}
+	for _, device := range devices {
+		if device.IPAddress == "" || !device.IsApproved() {
+			continue
+		}
+		if !matches(filter.DeviceTypes, device.DeviceType) || !matches(filter.Statuses, device.Status) {
+			continue
+		}
+
+		// Keys are applied in sorted order so that the first of two keys with the
+		// same label name always wins (such keys are rejected for new labels)
+		keys := make([]string, 0, len(device.Labels))
+		for key := range device.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		labels := make(map[string]string)
+		for _, key := range keys {
+			name := PromLabelName(key)
+			if _, exists := labels[name]; exists || strings.HasPrefix(name, "__") {
+				continue
+			}
+			labels[name] = device.Labels[key]
+		}
+		labels["device_id"] = device.DeviceID
+		labels["device_type"] = device.DeviceType
+		if s, ok := settingsMap[device.DeviceType]; ok {
+			labels["__metrics_path__"] = s.MetricsPath
+			labels["__scrape_interval__"] = s.Interval
+			if s.ScrapeTimeout != "" {
+				labels["__scrape_timeout__"] = s.ScrapeTimeout
+			}
+		}
+
+		groups = append(groups, TargetGroup{
+			Targets: []string{fmt.Sprintf("%s:%d", device.IPAddress, device.Port)},
+			Labels:  labels,
+		})
+	}
+
+	return groups, nil
+}
+
+// matches reports whether value is in values (an empty list matches everything)
+func matches(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// PromLabelName converts a device label key (e.g. example.com/rack) into a valid
+// Prometheus label name by replacing unsupported characters with underscores
+func PromLabelName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')
+		if valid {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
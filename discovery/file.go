@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// File SD formats (FILE_SD_FORMAT)
+const (
+	FileFormatJSON = "json"
+	FileFormatYAML = "yaml"
+)
+
+// fileWriter rewrites the file_sd_configs target file when notified
+type fileWriter struct {
+	path    string
+	format  string
+	trigger chan struct{}
+}
+
+var activeFileWriter *fileWriter
+
+// StartFileSD writes the targets of all approved devices to a file_sd_configs
+// file in dir (edge-devices.json or edge-devices.yaml) and keeps it up to date.
+// The file is rewritten after Notify is called; writes are atomic (temp file + rename).
+func StartFileSD(dir, format string) error {
+	if activeFileWriter != nil {
+		return fmt.Errorf("file SD already running")
+	}
+
+	switch format {
+	case FileFormatJSON, FileFormatYAML:
+	default:
+		return fmt.Errorf("invalid file SD format %q (expected json or yaml)", format)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create file SD directory: %w", err)
+	}
+
+	w := &fileWriter{
+		path:    filepath.Join(dir, "edge-devices."+format),
+		format:  format,
+		trigger: make(chan struct{}, 1),
+	}
+	if err := w.write(); err != nil {
+		return err
+	}
+
+	go w.run()
+
+	activeFileWriter = w
+	log.Printf("File SD started (%s)", w.path)
+	return nil
+}
+
+// Notify requests a rewrite of the file SD target file if file SD is enabled
+// Calls are coalesced while a write is pending
+func Notify() {
+	w := activeFileWriter
+	if w == nil {
+		return
+	}
+
+	select {
+	case w.trigger <- struct{}{}:
+	default: // A rewrite is already pending
+	}
+}
+
+// run rewrites the target file whenever a notification arrives
+func (w *fileWriter) run() {
+	for range w.trigger {
+		if err := w.write(); err != nil {
+			log.Printf("File SD: %v", err)
+		}
+	}
+}
+
+// write renders the current targets and atomically replaces the target file
+func (w *fileWriter) write() error {
+	groups, err := Targets(Filter{})
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if w.format == FileFormatYAML {
+		data, err = yaml.Marshal(groups)
+	} else {
+		data, err = json.MarshalIndent(groups, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode targets: %w", err)
+	}
+
+	// Write to a temp file in the same directory and rename it over the target,
+	// so Prometheus never reads a partially written file
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), ".edge-devices-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write targets: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write targets: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write targets: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", w.path, err)
+	}
+	return nil
+}
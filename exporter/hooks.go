@@ -0,0 +1,31 @@
+package exporter
+
+import (
+	"sync"
+)
+
+// ReloadedFunc is called after a device acknowledged a reload request
+type ReloadedFunc func(deviceID string)
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []ReloadedFunc
+)
+
+// OnReloaded registers a function called whenever a device acknowledges a
+// reload (outbox deliveries and manual reloads). Hooks run on their own
+// goroutine so that they may call back into the device.
+func OnReloaded(fn ReloadedFunc) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// notifyReloaded runs the registered hooks in the background
+func notifyReloaded(deviceID string) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, fn := range hooks {
+		go fn(deviceID)
+	}
+}
@@ -0,0 +1,183 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"edge-metrics-server/fanout"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+)
+
+// Outbox timing (due job polling, jobs per batch and how long a claimed job is held)
+const (
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+	claimLease         = 30 * time.Second
+)
+
+var (
+	maxAttempts = 20
+	retryBase   = 5 * time.Second
+	retryMax    = 10 * time.Minute
+
+	// kick wakes the outbox worker before the next poll; calls are coalesced
+	kick = make(chan struct{}, 1)
+)
+
+// Configure sets the maximum number of delivery attempts of a reload job and
+// the exponential backoff between attempts (base, doubled per attempt, capped at max)
+// Non-positive values keep the current setting
+func Configure(attempts int, base, max time.Duration) {
+	if attempts > 0 {
+		maxAttempts = attempts
+	}
+	if base > 0 {
+		retryBase = base
+	}
+	if max > 0 {
+		retryMax = max
+	}
+}
+
+// StartOutbox starts a background goroutine that delivers due reload jobs
+// Jobs left claimed by a previous run become due again once their lease expires
+func StartOutbox() {
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			for DeliverDue() == outboxBatchSize {
+				// Full batch, more jobs may be due
+			}
+			select {
+			case <-ticker.C:
+			case <-kick:
+			}
+		}
+	}()
+}
+
+// Enqueue queues a reload of a device in the outbox without delivering it
+// Use Deliver to attempt it right away, or Queue to leave it to the outbox worker.
+func Enqueue(deviceID, reason string) (int64, error) {
+	return repository.EnqueueReload(deviceID, reason)
+}
+
+// Queue queues a reload of a device and wakes the outbox worker to deliver it
+func Queue(deviceID, reason string) (int64, error) {
+	id, err := Enqueue(deviceID, reason)
+	if err != nil {
+		return 0, err
+	}
+	wake()
+	return id, nil
+}
+
+// Deliver makes a delivery attempt of a queued reload job right away
+// Returns the attempt result and the job status afterwards (pending if it will
+// be retried). If the job is being delivered by someone else or is not due, no
+// attempt is made and the status is pending.
+func Deliver(ctx context.Context, jobID int64) (ReloadResult, string) {
+	job, err := repository.ClaimReloadJob(jobID, claimLease)
+	if err != nil {
+		log.Printf("Reload outbox: failed to claim job %d: %v", jobID, err)
+		return ReloadResult{Error: "failed to claim reload job"}, models.ReloadPending
+	}
+	if job == nil {
+		return ReloadResult{Error: "reload already in progress"}, models.ReloadPending
+	}
+	return attempt(ctx, job)
+}
+
+// DeliverDue makes a delivery attempt of every due reload job (up to one batch) in parallel
+// Returns the number of due jobs found
+func DeliverDue() int {
+	ids, err := repository.DueReloadJobs(outboxBatchSize)
+	if err != nil {
+		log.Printf("Reload outbox: failed to fetch due jobs: %v", err)
+		return 0
+	}
+
+	fanout.Run(context.Background(), len(ids), func(ctx context.Context, i int) {
+		Deliver(ctx, ids[i])
+	})
+
+	return len(ids)
+}
+
+// attempt delivers a claimed reload job and records the outcome
+func attempt(ctx context.Context, job *models.ReloadJob) (ReloadResult, string) {
+	var result ReloadResult
+	status := models.ReloadDelivered
+	nextAttemptAt := time.Now()
+
+	device, err := repository.GetByDeviceID(job.DeviceID)
+	switch {
+	case err != nil:
+		result = ReloadResult{Error: fmt.Sprintf("failed to fetch device: %v", err)}
+	case device == nil:
+		result = ReloadResult{Error: "Device not found"}
+		status = models.ReloadCancelled
+	default:
+		result = Reload(ctx, *device)
+	}
+
+	if !result.Success && status != models.ReloadCancelled {
+		if job.Attempts+1 >= maxAttempts {
+			status = models.ReloadFailed
+		} else {
+			status = models.ReloadPending
+			nextAttemptAt = nextAttemptAt.Add(backoff(job.Attempts + 1))
+		}
+	}
+
+	recorded, err := repository.FinishReloadAttempt(job, status, result.Error, nextAttemptAt)
+	if err != nil {
+		log.Printf("Reload outbox: failed to record attempt of job %d: %v", job.ID, err)
+		return result, models.ReloadPending
+	}
+	if !recorded {
+		// Another change was coalesced into the job meanwhile, it stays pending and due
+		log.Printf("Reload outbox: %s changed during delivery, reloading again", job.DeviceID)
+		wake()
+		return result, models.ReloadPending
+	}
+
+	switch status {
+	case models.ReloadDelivered:
+		log.Printf("Reload delivered to device: %s (%s, attempt %d)", job.DeviceID, job.Reason, job.Attempts+1)
+	case models.ReloadPending:
+		log.Printf("Failed to deliver reload to %s: %s (attempt %d/%d, retrying at %s)",
+			job.DeviceID, result.Error, job.Attempts+1, maxAttempts, nextAttemptAt.Format(time.RFC3339))
+	case models.ReloadFailed:
+		log.Printf("Giving up reload of %s after %d attempts: %s", job.DeviceID, job.Attempts+1, result.Error)
+	case models.ReloadCancelled:
+		log.Printf("Reload of %s cancelled: device deleted", job.DeviceID)
+	}
+
+	return result, status
+}
+
+// backoff returns the delay before the next attempt after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	delay := retryBase
+	for i := 1; i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	if delay > retryMax {
+		delay = retryMax
+	}
+	return delay
+}
+
+// wake requests an outbox run before the next poll
+func wake() {
+	select {
+	case kick <- struct{}{}:
+	default: // A run is already requested
+	}
+}
@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"edge-metrics-server/models"
+)
+
+// ErrNoIPAddress is the reload error of devices that have not reported an IP address yet
+const ErrNoIPAddress = "No IP address"
+
+// Request timeouts (reload request, running config fetch)
+const (
+	reloadTimeout      = 2 * time.Second
+	fetchConfigTimeout = 5 * time.Second
+)
+
+// ReloadResult holds the outcome of a single reload request
+type ReloadResult struct {
+	Success   bool
+	Error     string
+	LatencyMs int64
+}
+
+// Reload sends a signed reload request (POST /reload) to the exporter of a device,
+// aborting when ctx is done and measuring the request latency
+func Reload(ctx context.Context, device models.DeviceConfig) ReloadResult {
+	if device.IPAddress == "" {
+		return ReloadResult{Error: ErrNoIPAddress}
+	}
+
+	reloadURL := fmt.Sprintf("http://%s:%d/reload", device.IPAddress, device.ReloadPort)
+	client := &http.Client{Timeout: reloadTimeout}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reloadURL, nil)
+	if err != nil {
+		return ReloadResult{Error: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := Sign(req, device.DeviceID, nil); err != nil {
+		return ReloadResult{Error: fmt.Sprintf("Failed to sign reload request: %v", err)}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := time.Since(start).Milliseconds()
+	if err != nil {
+		return ReloadResult{Error: err.Error(), LatencyMs: latency}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		notifyReloaded(device.DeviceID)
+		return ReloadResult{Success: true, LatencyMs: latency}
+	}
+	return ReloadResult{Error: fmt.Sprintf("HTTP %d", resp.StatusCode), LatencyMs: latency}
+}
+
+// FetchConfig fetches the config the exporter of a device is running (GET /config on its reload port)
+func FetchConfig(ctx context.Context, device models.DeviceConfig) (map[string]interface{}, error) {
+	if device.IPAddress == "" {
+		return nil, errors.New(ErrNoIPAddress)
+	}
+
+	configURL := fmt.Sprintf("http://%s:%d/config", device.IPAddress, device.ReloadPort)
+	client := &http.Client{Timeout: fetchConfigTimeout}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, configURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := Sign(req, device.DeviceID, nil); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("device returned HTTP %d", resp.StatusCode)
+	}
+
+	config := make(map[string]interface{})
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid config from device: %w", err)
+	}
+	return config, nil
+}
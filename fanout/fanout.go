@@ -0,0 +1,78 @@
+package fanout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	concurrency = 20
+	deadline    = 30 * time.Second
+)
+
+// Configure sets the worker pool size and the overall deadline for Run
+// Non-positive values keep the current setting
+func Configure(workers int, timeout time.Duration) {
+	if workers > 0 {
+		concurrency = workers
+	}
+	if timeout > 0 {
+		deadline = timeout
+	}
+}
+
+// Deadline returns the configured overall deadline for Run
+func Deadline() time.Duration {
+	return deadline
+}
+
+// Run calls fn for indexes 0..n-1 using a bounded pool of workers.
+// All calls share a context that is cancelled when the overall deadline
+// expires or the parent context is done; indexes that were not started
+// by then are skipped.
+// Returns which indexes were run.
+func Run(parent context.Context, n int, fn func(ctx context.Context, i int)) []bool {
+	return RunWithin(parent, deadline, n, fn)
+}
+
+// RunWithin is like Run with its own overall deadline instead of the
+// configured one, for background jobs that are not bound by a request
+func RunWithin(parent context.Context, timeout time.Duration, n int, fn func(ctx context.Context, i int)) []bool {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	started := make([]bool, n)
+	jobs := make(chan int)
+
+	workers := concurrency
+	if workers > n {
+		workers = n
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(ctx, i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+			started[i] = true
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return started
+}
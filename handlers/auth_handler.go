@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"edge-metrics-server/auth"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTokenRequest represents the request body for POST /auth/tokens
+type CreateTokenRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Role      string `json:"role" binding:"required"`
+	ExpiresIn string `json:"expires_in"` // Go duration, e.g. 720h (never expires if empty)
+}
+
+// WhoAmI handles GET /auth/whoami
+// Returns the principal the request was authenticated as
+func WhoAmI(c *gin.Context) {
+	principal := auth.FromContext(c)
+	if principal == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"auth_enabled": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"auth_enabled": true,
+		"name":         principal.Name,
+		"role":         principal.Role,
+		"method":       principal.Method,
+	})
+}
+
+// ListAPITokens handles GET /auth/tokens
+func ListAPITokens(c *gin.Context) {
+	log.Printf("List API tokens request")
+
+	tokens, err := repository.GetAPITokens()
+	if err != nil {
+		log.Printf("Error fetching API tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch API tokens",
+		})
+		return
+	}
+
+	if tokens == nil {
+		tokens = []models.APIToken{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"total":  len(tokens),
+	})
+}
+
+// CreateAPIToken handles POST /auth/tokens
+// The token is only returned in this response; the server keeps its hash.
+func CreateAPIToken(c *gin.Context) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+	log.Printf("Create API token request: %s (%s)", req.Name, req.Role)
+
+	if !auth.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_token_request",
+			Message: fmt.Sprintf("Unknown role %q (expected viewer, operator or admin)", req.Role),
+		})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_token_request",
+				Message: fmt.Sprintf("expires_in must be a positive duration: %s", req.ExpiresIn),
+			})
+			return
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	existing, err := repository.GetAPITokens()
+	if err != nil {
+		log.Printf("Error fetching API tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch API tokens",
+		})
+		return
+	}
+	for _, token := range existing {
+		if token.Name == req.Name {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error:   "Token already exists",
+				Message: fmt.Sprintf("An API token named %s already exists", req.Name),
+			})
+			return
+		}
+	}
+
+	token, hash, prefix, err := auth.GenerateToken()
+	if err != nil {
+		log.Printf("Error generating API token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to generate API token",
+		})
+		return
+	}
+
+	record := models.APIToken{
+		Name:      req.Name,
+		Role:      req.Role,
+		TokenHash: hash,
+		Prefix:    prefix,
+	}
+	if err := repository.CreateAPIToken(&record, expiresAt); err != nil {
+		log.Printf("Error saving API token %s: %v", req.Name, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to save API token",
+		})
+		return
+	}
+
+	response := gin.H{
+		"token":      token,
+		"id":         record.ID,
+		"name":       record.Name,
+		"role":       record.Role,
+		"prefix":     record.Prefix,
+		"created_at": record.CreatedAt,
+	}
+	if record.ExpiresAt != "" {
+		response["expires_at"] = record.ExpiresAt
+	}
+
+	log.Printf("Created API token %s (%s)", record.Name, record.Role)
+	c.JSON(http.StatusCreated, response)
+}
+
+// DeleteAPIToken handles DELETE /auth/tokens/:id
+func DeleteAPIToken(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_token_id",
+			Message: fmt.Sprintf("Invalid token ID: %s", c.Param("id")),
+		})
+		return
+	}
+	log.Printf("Delete API token request: %d", id)
+
+	if err := repository.DeleteAPIToken(id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "Token not found",
+				Message: fmt.Sprintf("No API token with ID %d", id),
+			})
+			return
+		}
+		log.Printf("Error deleting API token %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to delete API token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "deleted",
+		"id":     id,
+	})
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// BulkSelector selects the devices of a bulk operation
+// All given criteria must match; at least one is required
+type BulkSelector struct {
+	DeviceIDs  []string `json:"device_ids"`
+	DeviceType string   `json:"device_type"`
+	Labels     string   `json:"labels"` // Label selector, e.g. site=lab2,rack!=r1
+}
+
+// BulkPatchRequest represents the request body for POST /bulk/config/patch
+type BulkPatchRequest struct {
+	Selector BulkSelector           `json:"selector"`
+	Patch    map[string]interface{} `json:"patch" binding:"required"`
+	DryRun   bool                   `json:"dry_run"`
+}
+
+// BulkReloadRequest represents the request body for POST /bulk/devices/reload
+type BulkReloadRequest struct {
+	Selector BulkSelector `json:"selector"`
+	DryRun   bool         `json:"dry_run"`
+}
+
+// BulkPatchConfig handles POST /bulk/config/patch
+// Applies a JSON merge patch (same semantics as PATCH /config/:device_id) to all
+// selected devices. The patch is validated for every device first; if any device
+// would end up invalid nothing is saved. With dry_run the changes are only reported.
+func BulkPatchConfig(c *gin.Context) {
+	log.Printf("Bulk config patch request")
+
+	var req BulkPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if _, exists := req.Patch["ip_address"]; exists {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_patch",
+			Message: "ip_address cannot be patched in bulk",
+		})
+		return
+	}
+
+	devices, notFound, ok := selectBulkDevices(c, req.Selector)
+	if !ok {
+		return
+	}
+
+	// Apply the patch to copies and validate every device before saving anything
+	patched := make([]models.DeviceConfig, len(devices))
+	results := make([]gin.H, len(devices))
+	invalid := 0
+	for i := range devices {
+		patched[i] = cloneConfig(&devices[i])
+		result := gin.H{"device_id": devices[i].DeviceID}
+		results[i] = result
+
+		if errResp := applyConfigPatch(&patched[i], req.Patch); errResp != nil {
+			result["status"] = "invalid"
+			result["error"] = errResp.Error
+			result["message"] = errResp.Message
+			if len(errResp.Details) > 0 {
+				result["details"] = errResp.Details
+			}
+			invalid++
+			continue
+		}
+
+		changes, err := diffConfigs(&devices[i], &patched[i])
+		if err != nil {
+			log.Printf("Error diffing config for %s: %v", devices[i].DeviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to compare device configurations",
+			})
+			return
+		}
+		result["changes"] = changes
+		if len(changes) == 0 {
+			result["status"] = "unchanged"
+		} else if req.DryRun {
+			result["status"] = "would_patch"
+		} else {
+			result["status"] = "pending"
+		}
+	}
+
+	if invalid > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "invalid_patch",
+			"message":   "Patch is invalid for some selected devices, nothing was saved",
+			"results":   results,
+			"not_found": notFound,
+		})
+		return
+	}
+
+	// Save changed devices
+	changed := make([]models.DeviceConfig, 0)
+	changedIndex := make([]int, 0)
+	failed := 0
+	for i := range patched {
+		if results[i]["status"] != "pending" {
+			continue
+		}
+
+		// Skip devices changed since they were validated
+		if err := repository.UpdateIfVersion(patched[i].DeviceID, &patched[i], devices[i].Version); err != nil {
+			results[i]["status"] = "failed"
+			results[i]["error"] = "Failed to update device configuration"
+			if err == repository.ErrVersionConflict || err == sql.ErrNoRows {
+				results[i]["error"] = "Device was modified concurrently"
+			} else {
+				log.Printf("Error updating config for %s: %v", patched[i].DeviceID, err)
+			}
+			failed++
+			continue
+		}
+
+		recordRevision(&patched[i], "bulk_patch")
+		notifyConfigChanged(patched[i].DeviceID)
+		results[i]["status"] = "patched"
+
+		changed = append(changed, patched[i])
+		changedIndex = append(changedIndex, i)
+	}
+
+	// Trigger reloads of the patched devices in parallel
+	if len(changed) > 0 {
+		reloads, _, _ := reloadDevices(c.Request.Context(), changed, "bulk_patch")
+		for j, reload := range reloads {
+			results[changedIndex[j]]["reload_triggered"] = reload["status"] == "reloaded"
+			if reload["retrying"] == true {
+				results[changedIndex[j]]["reload_retrying"] = true
+			}
+		}
+	}
+
+	changedCount := 0
+	for _, result := range results {
+		if result["status"] == "patched" || result["status"] == "would_patch" {
+			changedCount++
+		}
+	}
+
+	log.Printf("Bulk config patch: %d matched, %d changed, %d failed (dry_run=%t)",
+		len(devices), changedCount, failed, req.DryRun)
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":   req.DryRun,
+		"matched":   len(devices),
+		"changed":   changedCount,
+		"failed":    failed,
+		"results":   results,
+		"not_found": notFound,
+	})
+}
+
+// BulkReloadDevices handles POST /bulk/devices/reload
+// Triggers reloads on the selected devices only; with dry_run the devices are only listed
+func BulkReloadDevices(c *gin.Context) {
+	log.Printf("Bulk reload request")
+
+	var req BulkReloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	devices, notFound, ok := selectBulkDevices(c, req.Selector)
+	if !ok {
+		return
+	}
+
+	if req.DryRun {
+		results := make([]gin.H, 0, len(devices))
+		for _, device := range devices {
+			result := gin.H{
+				"device_id": device.DeviceID,
+				"status":    "would_reload",
+			}
+			if device.IPAddress == "" {
+				result["status"] = "skipped"
+				result["error"] = "No IP address"
+			}
+			results = append(results, result)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"dry_run":   true,
+			"results":   results,
+			"total":     len(devices),
+			"not_found": notFound,
+		})
+		return
+	}
+
+	results, success, failed := reloadDevices(c.Request.Context(), devices, "")
+
+	log.Printf("Bulk reload: %d success, %d failed", success, failed)
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":   false,
+		"results":   results,
+		"total":     len(devices),
+		"success":   success,
+		"failed":    failed,
+		"not_found": notFound,
+	})
+}
+
+// selectBulkDevices returns the devices matching a bulk selector and the
+// requested device IDs that do not exist
+// Returns false after writing an error response if the selector is empty or invalid
+func selectBulkDevices(c *gin.Context, selector BulkSelector) ([]models.DeviceConfig, []string, bool) {
+	if len(selector.DeviceIDs) == 0 && selector.DeviceType == "" && selector.Labels == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "selector_required",
+			Message: "selector must specify device_ids, device_type or labels",
+		})
+		return nil, nil, false
+	}
+
+	labelSelector := labels.Everything()
+	if selector.Labels != "" {
+		parsed, err := labels.Parse(selector.Labels)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_selector",
+				Message: err.Error(),
+			})
+			return nil, nil, false
+		}
+		labelSelector = parsed
+	}
+
+	devices, err := repository.GetAll()
+	if err != nil {
+		log.Printf("Error fetching devices: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch devices",
+		})
+		return nil, nil, false
+	}
+
+	wanted := make(map[string]bool, len(selector.DeviceIDs))
+	for _, id := range selector.DeviceIDs {
+		wanted[id] = true
+	}
+
+	found := make(map[string]bool)
+	matched := make([]models.DeviceConfig, 0)
+	for _, device := range devices {
+		if len(wanted) > 0 && !wanted[device.DeviceID] {
+			continue
+		}
+		found[device.DeviceID] = true
+
+		if selector.DeviceType != "" && device.DeviceType != selector.DeviceType {
+			continue
+		}
+		if !labelSelector.Matches(labels.Set(device.Labels)) {
+			continue
+		}
+		matched = append(matched, device)
+	}
+
+	notFound := make([]string, 0)
+	for _, id := range selector.DeviceIDs {
+		if !found[id] {
+			notFound = append(notFound, id)
+		}
+	}
+
+	return matched, notFound, true
+}
+
+// cloneConfig copies a device config so that patching the copy leaves the original intact
+func cloneConfig(config *models.DeviceConfig) models.DeviceConfig {
+	clone := *config
+
+	if config.EnabledMetrics != nil {
+		clone.EnabledMetrics = append([]string(nil), config.EnabledMetrics...)
+	}
+	if config.ExtraConfig != nil {
+		clone.ExtraConfig = make(map[string]interface{}, len(config.ExtraConfig))
+		for key, value := range config.ExtraConfig {
+			clone.ExtraConfig[key] = value
+		}
+	}
+	if config.Labels != nil {
+		clone.Labels = make(map[string]string, len(config.Labels))
+		for key, value := range config.Labels {
+			clone.Labels[key] = value
+		}
+	}
+
+	return clone
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"edge-metrics-server/catalog"
+	"edge-metrics-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCatalog handles GET /catalog
+func GetCatalog(c *gin.Context) {
+	log.Printf("Metric catalog request")
+
+	if !catalog.IsLoaded() {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Catalog not loaded",
+			Message: "Metric catalog is not available on this server",
+		})
+		return
+	}
+
+	deviceTypes := make([]catalog.DeviceTypeCatalog, 0)
+	for _, deviceType := range catalog.DeviceTypes() {
+		if entry, ok := catalog.Get(deviceType); ok {
+			deviceTypes = append(deviceTypes, *entry)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_types": deviceTypes,
+		"total":        len(deviceTypes),
+	})
+}
+
+// GetDeviceTypeCatalog handles GET /catalog/:device_type
+func GetDeviceTypeCatalog(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	log.Printf("Metric catalog request for device type: %s", deviceType)
+
+	if !catalog.IsLoaded() {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Catalog not loaded",
+			Message: "Metric catalog is not available on this server",
+		})
+		return
+	}
+
+	entry, ok := catalog.Get(deviceType)
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Device type not found",
+			Message: fmt.Sprintf("No metric catalog for device type: %s", deviceType),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// validateEnabledMetrics checks enabled_metrics against the metric catalog.
+// Writes a 400 response and returns false if any metric is unknown.
+func validateEnabledMetrics(c *gin.Context, config *models.DeviceConfig) bool {
+	if errResp := checkEnabledMetrics(config); errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return false
+	}
+	return true
+}
+
+// checkEnabledMetrics checks enabled_metrics against the metric catalog.
+// Returns the error response if any metric is unknown, nil otherwise.
+func checkEnabledMetrics(config *models.DeviceConfig) *models.ErrorResponse {
+	if len(config.EnabledMetrics) == 0 {
+		return nil
+	}
+
+	var blocks []string
+	for key := range config.ExtraConfig {
+		blocks = append(blocks, key)
+	}
+
+	unknown := catalog.UnknownMetrics(config.DeviceType, blocks, config.EnabledMetrics)
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	log.Printf("Unknown metrics for %s (%s): %v", config.DeviceID, config.DeviceType, unknown)
+	return &models.ErrorResponse{
+		Error:    "unknown_metrics",
+		DeviceID: config.DeviceID,
+		Message: fmt.Sprintf("Unknown metrics for device type %s: %s",
+			config.DeviceType, strings.Join(unknown, ", ")),
+	}
+}
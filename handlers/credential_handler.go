@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"edge-metrics-server/auth"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeviceCredential handles GET /devices/:device_id/credential
+// Returns when the device token was issued and last used (never the token itself)
+func GetDeviceCredential(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	log.Printf("Credential request for device: %s", deviceID)
+
+	credential, err := repository.GetDeviceCredential(deviceID)
+	if err != nil {
+		log.Printf("Error fetching credential for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device credential",
+		})
+		return
+	}
+
+	if credential == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:    "Credential not found",
+			DeviceID: deviceID,
+			Message:  "No device token was issued for this device",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, credential)
+}
+
+// RotateDeviceCredential handles POST /devices/:device_id/credential/rotate
+// Issues a new device token (or the first one, for devices registered before
+// device credentials existed). The previous token stops working immediately.
+func RotateDeviceCredential(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	log.Printf("Rotate credential request for device: %s", deviceID)
+
+	exists, err := repository.Exists(deviceID)
+	if err != nil {
+		log.Printf("Error checking device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to check device existence",
+		})
+		return
+	}
+
+	if !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:    "Device not found",
+			DeviceID: deviceID,
+		})
+		return
+	}
+
+	credential, err := auth.IssueDeviceCredential(deviceID)
+	if err != nil {
+		log.Printf("Error rotating credential for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to rotate device credential",
+		})
+		return
+	}
+
+	log.Printf("Rotated credential of device %s (%s)", deviceID, credential.Prefix)
+	c.JSON(http.StatusOK, gin.H{
+		"status":       "rotated",
+		"device_id":    deviceID,
+		"device_token": credential.Token,
+		"prefix":       credential.Prefix,
+		"created_at":   credential.CreatedAt,
+	})
+}
+
+// issueDeviceToken issues the credential of a newly registered device
+// Returns the token to hand out once, or "" if it could not be issued
+// (the device can be given one later with the rotate endpoint).
+func issueDeviceToken(deviceID string) string {
+	credential, err := auth.IssueDeviceCredential(deviceID)
+	if err != nil {
+		log.Printf("Error issuing credential for %s: %v", deviceID, err)
+		return ""
+	}
+	log.Printf("Issued credential for device %s (%s)", deviceID, credential.Prefix)
+	return credential.Token
+}
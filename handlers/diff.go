@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"edge-metrics-server/models"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configToMap builds the exporter-facing representation of a device config
+// (standard fields plus extra_config spread at the top level, as served by GET /config/:device_id)
+func configToMap(config *models.DeviceConfig) gin.H {
+	response := gin.H{
+		"device_type": config.DeviceType,
+		"port":        config.Port,
+		"reload_port": config.ReloadPort,
+	}
+
+	if len(config.EnabledMetrics) > 0 {
+		response["enabled_metrics"] = config.EnabledMetrics
+	}
+
+	// Spread extra_config into response (e.g., "shelly": {...}, "jetson": {...})
+	for key, value := range config.ExtraConfig {
+		response[key] = value
+	}
+
+	return response
+}
+
+// normalizeJSON round-trips a value through JSON so that numbers, slices
+// and maps have the same types as values decoded from a request or the database
+func normalizeJSON(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{})
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// diffConfigs returns field-level differences between two configs
+func diffConfigs(from, to *models.DeviceConfig) ([]models.ConfigChange, error) {
+	fromMap, err := normalizeJSON(configToMap(from))
+	if err != nil {
+		return nil, err
+	}
+	fromMap["ip_address"] = from.IPAddress
+
+	toMap, err := normalizeJSON(configToMap(to))
+	if err != nil {
+		return nil, err
+	}
+	toMap["ip_address"] = to.IPAddress
+
+	// Labels and profiles are compared only when both configs carry them
+	// (revisions do not store them)
+	if from.Labels != nil && to.Labels != nil {
+		fromMap["labels"] = labelsToMap(from.Labels)
+		toMap["labels"] = labelsToMap(to.Labels)
+	}
+	if from.Profiles != nil && to.Profiles != nil {
+		fromMap["profiles"] = from.Profiles
+		toMap["profiles"] = to.Profiles
+	}
+
+	return redactChanges(diffMaps("", fromMap, toMap)), nil
+}
+
+// labelsToMap converts labels into a JSON object for diffMaps
+func labelsToMap(labels map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(labels))
+	for key, value := range labels {
+		result[key] = value
+	}
+	return result
+}
+
+// diffMaps recursively compares two JSON objects and returns changes with dotted paths
+func diffMaps(prefix string, from, to map[string]interface{}) []models.ConfigChange {
+	keys := make(map[string]bool)
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	changes := []models.ConfigChange{}
+	for _, key := range sortedKeys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		oldValue, inFrom := from[key]
+		newValue, inTo := to[key]
+
+		switch {
+		case !inFrom:
+			changes = append(changes, models.ConfigChange{Path: path, Op: "added", New: newValue})
+		case !inTo:
+			changes = append(changes, models.ConfigChange{Path: path, Op: "removed", Old: oldValue})
+		default:
+			oldMap, oldIsMap := oldValue.(map[string]interface{})
+			newMap, newIsMap := newValue.(map[string]interface{})
+			if oldIsMap && newIsMap {
+				changes = append(changes, diffMaps(path, oldMap, newMap)...)
+			} else if !reflect.DeepEqual(oldValue, newValue) {
+				changes = append(changes, models.ConfigChange{Path: path, Op: "changed", Old: oldValue, New: newValue})
+			}
+		}
+	}
+
+	return changes
+}
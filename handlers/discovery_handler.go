@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"edge-metrics-server/discovery"
+	"edge-metrics-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetHTTPSDTargets handles GET /discovery/targets
+// Returns the devices in Prometheus http_sd_config format. Optional filters:
+// ?device_type=shelly,jetson_orin and ?health=healthy (comma separated)
+func GetHTTPSDTargets(c *gin.Context) {
+	log.Printf("HTTP SD targets request")
+
+	filter := discovery.Filter{
+		DeviceTypes: splitQueryList(c.Query("device_type")),
+		Statuses:    splitQueryList(c.Query("health")),
+	}
+
+	groups, err := discovery.Targets(filter)
+	if err != nil {
+		log.Printf("Error building SD targets: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to build discovery targets",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+// splitQueryList splits a comma separated query value, dropping empty items
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"edge-metrics-server/exporter"
+	"edge-metrics-server/fanout"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// syncStatuses are the valid ?status filters of GET /drift
+var syncStatuses = map[string]bool{
+	models.SyncInSync:  true,
+	models.SyncDrifted: true,
+	models.SyncPending: true,
+	models.SyncUnknown: true,
+}
+
+// Exporters may acknowledge a reload before they finished applying it, so the
+// running config is compared after a settle delay and again while it differs
+var (
+	driftSettleDelay   = 2 * time.Second
+	driftCheckAttempts = 3
+)
+
+// CheckDeviceSync compares the running config of a device with its stored
+// config and records the result. Registered as a reload hook, so every
+// acknowledged reload is followed by a drift check.
+func CheckDeviceSync(deviceID string) {
+	var device *models.DeviceConfig
+	var state *models.DeviceSyncState
+	for attempt := 1; attempt <= driftCheckAttempts; attempt++ {
+		time.Sleep(driftSettleDelay)
+
+		var err error
+		device, err = repository.GetByDeviceID(deviceID)
+		if err != nil {
+			log.Printf("Drift check: failed to fetch device %s: %v", deviceID, err)
+			return
+		}
+		if device == nil {
+			return // Deleted meanwhile
+		}
+
+		state = compareSync(context.Background(), *device)
+		if state.Status == models.SyncInSync {
+			break
+		}
+	}
+
+	saveSync(*device, state)
+}
+
+// GetDeviceDrift handles GET /devices/:device_id/drift
+// Returns the latest sync state of the device; ?refresh=true fetches the
+// running config from the device and compares it right away
+func GetDeviceDrift(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	log.Printf("Drift request for device: %s", deviceID)
+
+	device, err := repository.GetByDeviceID(deviceID)
+	if err != nil {
+		log.Printf("Error fetching device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device",
+		})
+		return
+	}
+
+	if device == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:    "Device not found",
+			DeviceID: deviceID,
+		})
+		return
+	}
+
+	var state *models.DeviceSyncState
+	if c.Query("refresh") == "true" {
+		state = checkSync(c.Request.Context(), *device)
+	} else {
+		state, err = repository.GetSyncState(deviceID)
+		if err != nil {
+			log.Printf("Error fetching sync state for %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to fetch device sync state",
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, currentSyncState(*device, state))
+}
+
+// GetDriftReport handles GET /drift
+// Returns the sync state of every device with a summary per status.
+// ?status=drifted,pending filters the devices (the summary always covers all devices);
+// ?refresh=true checks all devices with an IP address in parallel first.
+func GetDriftReport(c *gin.Context) {
+	log.Printf("Drift report request")
+
+	filter := make(map[string]bool)
+	for _, status := range splitQueryList(c.Query("status")) {
+		filter[status] = true
+		if !syncStatuses[status] {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_status",
+				Message: fmt.Sprintf("Unknown sync status %q (expected in_sync, drifted, pending or unknown)", status),
+			})
+			return
+		}
+	}
+
+	devices, err := repository.GetAll()
+	if err != nil {
+		log.Printf("Error fetching devices: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch devices",
+		})
+		return
+	}
+
+	stored, err := repository.GetAllSyncStates()
+	if err != nil {
+		log.Printf("Error fetching sync states: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device sync states",
+		})
+		return
+	}
+
+	checked := make([]*models.DeviceSyncState, len(devices))
+	if c.Query("refresh") == "true" {
+		fanout.Run(c.Request.Context(), len(devices), func(ctx context.Context, i int) {
+			if devices[i].IPAddress != "" {
+				checked[i] = checkSync(ctx, devices[i])
+			}
+		})
+	}
+
+	summary := map[string]int{
+		models.SyncInSync:  0,
+		models.SyncDrifted: 0,
+		models.SyncPending: 0,
+		models.SyncUnknown: 0,
+	}
+	states := make([]models.DeviceSyncState, 0, len(devices))
+	for i, device := range devices {
+		state := checked[i]
+		if state == nil {
+			if record, ok := stored[device.DeviceID]; ok {
+				state = &record
+			}
+		}
+
+		current := currentSyncState(device, state)
+		summary[current.Status]++
+		if len(filter) == 0 || filter[current.Status] {
+			states = append(states, current)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"devices": states,
+		"total":   len(states),
+		"summary": summary,
+	})
+}
+
+// checkSync fetches the running config of a device, compares it with the stored
+// effective config and saves the result. Returns the saved sync state.
+func checkSync(ctx context.Context, device models.DeviceConfig) *models.DeviceSyncState {
+	return saveSync(device, compareSync(ctx, device))
+}
+
+// compareSync fetches the running config of a device and compares it with the
+// stored effective config without saving the result
+func compareSync(ctx context.Context, device models.DeviceConfig) *models.DeviceSyncState {
+	state := &models.DeviceSyncState{
+		DeviceID:      device.DeviceID,
+		ConfigVersion: device.Version,
+	}
+
+	running, err := exporter.FetchConfig(ctx, device)
+	if err != nil {
+		state.Status = models.SyncUnknown
+		state.Error = fmt.Sprintf("Failed to fetch running config: %v", err)
+	} else if diff, err := compareRunningConfig(&device, running); err != nil {
+		state.Status = models.SyncUnknown
+		state.Error = fmt.Sprintf("Failed to compare configs: %v", err)
+	} else if len(diff) > 0 {
+		state.Status = models.SyncDrifted
+		state.Diff = diff
+	} else {
+		state.Status = models.SyncInSync
+		if revision, err := repository.GetLatestRevision(device.DeviceID); err != nil {
+			log.Printf("Error fetching latest revision for %s: %v", device.DeviceID, err)
+		} else if revision != nil {
+			state.AppliedRevision = revision.Revision
+		}
+	}
+	return state
+}
+
+// saveSync logs and saves the sync state of a device
+// Returns the saved sync state.
+func saveSync(device models.DeviceConfig, state *models.DeviceSyncState) *models.DeviceSyncState {
+	switch state.Status {
+	case models.SyncInSync:
+		log.Printf("Device %s is running its stored config (version %d)", device.DeviceID, device.Version)
+	case models.SyncDrifted:
+		log.Printf("Device %s config drifted: %d differences (version %d)", device.DeviceID, len(state.Diff), device.Version)
+	default:
+		log.Printf("Drift check of %s failed: %s", device.DeviceID, state.Error)
+	}
+
+	if err := repository.SaveSyncState(state, time.Now()); err != nil {
+		log.Printf("Error saving sync state for %s: %v", device.DeviceID, err)
+		return state
+	}
+
+	// Read back the applied revision and sync time kept from earlier checks
+	saved, err := repository.GetSyncState(device.DeviceID)
+	if err != nil || saved == nil {
+		return state
+	}
+	return saved
+}
+
+// currentSyncState returns the sync state of a device as reported by the API
+// A comparison against an older config version is reported as pending, since the
+// device has not been checked against its current config yet
+func currentSyncState(device models.DeviceConfig, state *models.DeviceSyncState) models.DeviceSyncState {
+	if state == nil {
+		state = &models.DeviceSyncState{
+			DeviceID: device.DeviceID,
+			Status:   models.SyncUnknown,
+			Error:    "Not checked yet",
+		}
+		if device.IPAddress == "" {
+			state.Error = "No IP address registered"
+		}
+		return *state
+	}
+
+	current := *state
+	if current.Status != models.SyncUnknown && current.ConfigVersion != device.Version {
+		current.Status = models.SyncPending
+	}
+	return current
+}
+
+// compareRunningConfig returns the differences between the stored effective config of a
+// device (old) and the config its exporter is running (new). Only fields managed by the
+// server are compared: a field missing on the device is drift, and so is a field only the
+// device has if an earlier revision set it (its removal was not applied). Fields the
+// exporter adds on its own are ignored.
+func compareRunningConfig(device *models.DeviceConfig, running map[string]interface{}) ([]models.ConfigChange, error) {
+	effective, err := effectiveConfig(device)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := repository.GetRevisions(device.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	managed := make(map[string]bool)
+	for _, revision := range revisions {
+		previous, err := normalizeJSON(configToMap(&revision.Config))
+		if err != nil {
+			return nil, err
+		}
+		collectPaths("", previous, managed)
+	}
+
+	expected, err := normalizeJSON(configToMap(effective))
+	if err != nil {
+		return nil, err
+	}
+	actual, err := normalizeJSON(running)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exporters report their metrics as a map of metric name to enabled flag
+	// (only compared when the server sets enabled_metrics)
+	if _, ok := actual["enabled_metrics"]; !ok && expected["enabled_metrics"] != nil {
+		if metrics, ok := actual["metrics"].(map[string]interface{}); ok {
+			enabled := []interface{}{}
+			for name, on := range metrics {
+				if on == true {
+					enabled = append(enabled, name)
+				}
+			}
+			actual["enabled_metrics"] = enabled
+		}
+	}
+
+	// Metric order is not significant
+	for _, config := range []map[string]interface{}{expected, actual} {
+		if metrics, ok := config["enabled_metrics"].([]interface{}); ok {
+			sort.Slice(metrics, func(i, j int) bool {
+				return fmt.Sprint(metrics[i]) < fmt.Sprint(metrics[j])
+			})
+		}
+	}
+
+	changes := []models.ConfigChange{}
+	for _, change := range diffMaps("", expected, actual) {
+		if change.Op == "added" && !managed[change.Path] {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return redactChanges(changes), nil
+}
+
+// collectPaths adds the dotted path of every field of a config map to paths
+func collectPaths(prefix string, config map[string]interface{}, paths map[string]bool) {
+	for key, value := range config {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		paths[path] = true
+		if nested, ok := value.(map[string]interface{}); ok {
+			collectPaths(path, nested, paths)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"edge-metrics-server/auth"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnrollDevice handles POST /devices/enroll
+// Called by an exporter on boot to create or update its own device entry.
+// If ENROLLMENT_TOKEN is set, the request must carry the same token
+// (X-Enrollment-Token header or "token" field). New devices are left
+// pending until approved when ENROLLMENT_REQUIRE_APPROVAL=true.
+// New devices get a device token in the response; re-enrolling devices must
+// send theirs (Authorization: Bearer) if they have one. Devices registered
+// before device credentials existed only get one here when ENROLLMENT_TOKEN
+// is set, otherwise from POST /devices/:device_id/credential/rotate.
+// Re-enrollment only changes an approved device when it is authenticated
+// with the device token or the enrollment token.
+func EnrollDevice(c *gin.Context) {
+	var req models.EnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	deviceID := req.DeviceID
+	log.Printf("Enroll request for device: %s", deviceID)
+
+	if !checkEnrollmentToken(c, req.Token) {
+		log.Printf("Rejected enrollment for %s: invalid enrollment token", deviceID)
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:    "invalid_enrollment_token",
+			DeviceID: deviceID,
+			Message:  "Missing or invalid enrollment token",
+		})
+		return
+	}
+
+	// Use the observed source IP if the exporter did not report one
+	ipAddress := req.IPAddress
+	if ipAddress == "" {
+		ipAddress = c.ClientIP()
+	}
+	if !isValidIP(ipAddress) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:    "invalid_ip_address",
+			DeviceID: deviceID,
+			Message:  fmt.Sprintf("Invalid IP address format: %s", ipAddress),
+		})
+		return
+	}
+
+	existing, err := repository.GetByDeviceID(deviceID)
+	if err != nil {
+		log.Printf("Error fetching device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device",
+		})
+		return
+	}
+
+	if existing == nil {
+		config := models.DeviceConfig{
+			DeviceID:       deviceID,
+			DeviceType:     req.DeviceType,
+			Port:           req.Port,
+			ReloadPort:     req.ReloadPort,
+			IPAddress:      ipAddress,
+			ApprovalStatus: models.ApprovalApproved,
+		}
+		applyTemplate(&config, nil)
+		if errResp := checkPorts(&config); errResp != nil {
+			c.JSON(http.StatusBadRequest, errResp)
+			return
+		}
+		if os.Getenv("ENROLLMENT_REQUIRE_APPROVAL") == "true" {
+			config.ApprovalStatus = models.ApprovalPending
+		}
+
+		if err := repository.Create(&config); err != nil {
+			log.Printf("Error enrolling device %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to enroll device",
+			})
+			return
+		}
+
+		recordRevision(&config, "enroll")
+		notifyConfigChanged(config.DeviceID)
+
+		response := gin.H{
+			"status":          "registered",
+			"device_id":       deviceID,
+			"ip_address":      ipAddress,
+			"approval_status": config.ApprovalStatus,
+		}
+		if token := issueDeviceToken(deviceID); token != "" {
+			response["device_token"] = token
+		}
+
+		log.Printf("Enrolled new device: %s (%s, approval: %s)", deviceID, ipAddress, config.ApprovalStatus)
+		c.JSON(http.StatusCreated, response)
+		return
+	}
+
+	if existing.ApprovalStatus == models.ApprovalRejected {
+		log.Printf("Rejected enrollment for %s: device was rejected", deviceID)
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error:    "enrollment_rejected",
+			DeviceID: deviceID,
+			Message:  "Device enrollment was rejected",
+		})
+		return
+	}
+
+	// A device that was issued a token must prove it is the same device
+	authenticated := os.Getenv("ENROLLMENT_TOKEN") != ""
+	credential, err := repository.GetDeviceCredential(deviceID)
+	if err != nil {
+		log.Printf("Error fetching credential for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to enroll device",
+		})
+		return
+	}
+	if credential != nil {
+		token, sent := auth.DeviceToken(c)
+		valid := false
+		if sent {
+			if valid, err = auth.VerifyDeviceToken(deviceID, token); err != nil {
+				log.Printf("Error verifying device token of %s: %v", deviceID, err)
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+					Error:   "Internal server error",
+					Message: "Failed to enroll device",
+				})
+				return
+			}
+		}
+		authenticated = valid
+		if !valid {
+			log.Printf("Rejected enrollment for %s: invalid device token", deviceID)
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error:    "invalid_device_token",
+				DeviceID: deviceID,
+				Message:  "Missing or invalid device token",
+			})
+			return
+		}
+	}
+
+	// Existing device: refresh the reported fields, keep metrics and extra config
+	updated := *existing
+	updated.DeviceType = req.DeviceType
+	updated.IPAddress = ipAddress
+	if req.Port != 0 {
+		updated.Port = req.Port
+	}
+	if req.ReloadPort != 0 {
+		updated.ReloadPort = req.ReloadPort
+	}
+
+	if errResp := checkPorts(&updated); errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	// A changed device type must still match the stored metrics and extra config
+	if updated.DeviceType != existing.DeviceType {
+		if errResp := checkEnabledMetrics(&updated); errResp != nil {
+			c.JSON(http.StatusBadRequest, errResp)
+			return
+		}
+		if errResp := checkExtraConfig(&updated, nil); errResp != nil {
+			c.JSON(errorResponseStatus(errResp), errResp)
+			return
+		}
+	}
+
+	changes, err := diffConfigs(existing, &updated)
+	if err != nil {
+		log.Printf("Error diffing config for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to enroll device",
+		})
+		return
+	}
+
+	// Without a device or enrollment token anyone could repoint an approved device
+	if len(changes) > 0 && !authenticated && existing.IsApproved() {
+		log.Printf("Rejected enrollment for %s: unauthenticated change of an approved device", deviceID)
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:    "invalid_device_token",
+			DeviceID: deviceID,
+			Message:  "Changing an approved device requires its device token or the enrollment token",
+		})
+		return
+	}
+
+	status := "unchanged"
+	if len(changes) > 0 {
+		if err := repository.Update(deviceID, &updated); err != nil {
+			log.Printf("Error updating enrolled device %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to enroll device",
+			})
+			return
+		}
+		recordRevision(&updated, "enroll")
+		notifyConfigChanged(updated.DeviceID)
+		status = "updated"
+
+		if updated.IPAddress != existing.IPAddress {
+			onIPChanged(&updated, existing.IPAddress, "enroll")
+		}
+	}
+
+	response := gin.H{
+		"status":          status,
+		"device_id":       deviceID,
+		"ip_address":      ipAddress,
+		"approval_status": updated.ApprovalStatus,
+	}
+	// Devices registered before device credentials existed get their token now,
+	// but only if the enrollment token proved the request may claim the device
+	if credential == nil && os.Getenv("ENROLLMENT_TOKEN") != "" {
+		if token := issueDeviceToken(deviceID); token != "" {
+			response["device_token"] = token
+		}
+	}
+
+	log.Printf("Re-enrolled device: %s (%s, %s)", deviceID, ipAddress, status)
+	c.JSON(http.StatusOK, response)
+}
+
+// ApproveDevice handles POST /devices/:device_id/approve
+func ApproveDevice(c *gin.Context) {
+	setApprovalStatus(c, models.ApprovalApproved)
+}
+
+// RejectDevice handles POST /devices/:device_id/reject
+func RejectDevice(c *gin.Context) {
+	setApprovalStatus(c, models.ApprovalRejected)
+}
+
+// setApprovalStatus updates the approval status of the device in the request path
+func setApprovalStatus(c *gin.Context, status string) {
+	deviceID := c.Param("device_id")
+	log.Printf("Set approval status %s request for device: %s", status, deviceID)
+
+	err := repository.SetApprovalStatus(deviceID, status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:    "Device not found",
+				DeviceID: deviceID,
+			})
+			return
+		}
+		log.Printf("Error setting approval status for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to update approval status",
+		})
+		return
+	}
+
+	notifyConfigChanged(deviceID)
+
+	log.Printf("Device %s is now %s", deviceID, status)
+	c.JSON(http.StatusOK, gin.H{
+		"status":    status,
+		"device_id": deviceID,
+	})
+}
+
+// checkEnrollmentToken verifies the enrollment token if ENROLLMENT_TOKEN is set
+func checkEnrollmentToken(c *gin.Context, bodyToken string) bool {
+	expected := os.Getenv("ENROLLMENT_TOKEN")
+	if expected == "" {
+		return true
+	}
+
+	token := c.GetHeader("X-Enrollment-Token")
+	if token == "" {
+		token = bodyToken
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
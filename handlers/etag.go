@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"edge-metrics-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPatchAttempts bounds the retries of PATCH /config/:device_id on concurrent writes
+const maxPatchAttempts = 3
+
+// configETag returns the ETag of a device config version
+func configETag(version int) string {
+	return fmt.Sprintf(`"v%d"`, version)
+}
+
+// etagListMatches checks if an If-Match / If-None-Match header value matches an ETag
+// Weak tags (W/"...") compare by their opaque value
+func etagListMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch evaluates the If-Match header against the current config (nil if the
+// device does not exist). Returns the version the write must still match (0 without
+// If-Match), or false after writing a 412 response.
+func checkIfMatch(c *gin.Context, deviceID string, current *models.DeviceConfig) (int, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return 0, true
+	}
+
+	if current == nil {
+		c.JSON(http.StatusPreconditionFailed, models.ErrorResponse{
+			Error:    "precondition_failed",
+			DeviceID: deviceID,
+			Message:  "If-Match given but the device does not exist",
+		})
+		return 0, false
+	}
+
+	etag := configETag(current.Version)
+	if !etagListMatches(header, etag) {
+		respondPreconditionFailed(c, deviceID, current.Version)
+		return 0, false
+	}
+
+	return current.Version, true
+}
+
+// respondPreconditionFailed writes a 412 response with the current ETag
+func respondPreconditionFailed(c *gin.Context, deviceID string, version int) {
+	message := "Config was modified concurrently, fetch it again"
+	if version > 0 {
+		c.Header("ETag", configETag(version))
+		message = fmt.Sprintf("Config was modified, current ETag is %s", configETag(version))
+	}
+	c.JSON(http.StatusPreconditionFailed, models.ErrorResponse{
+		Error:    "precondition_failed",
+		DeviceID: deviceID,
+		Message:  message,
+	})
+}
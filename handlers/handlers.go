@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"edge-metrics-server/exporter"
+	"edge-metrics-server/fanout"
 	"edge-metrics-server/models"
 	"edge-metrics-server/repository"
+	"edge-metrics-server/secrets"
+	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
@@ -19,6 +23,28 @@ func isValidIP(ip string) bool {
 	return net.ParseIP(ip) != nil
 }
 
+// checkPorts checks that the ports of a device config are valid TCP ports
+// Returns the error response if not, nil otherwise.
+func checkPorts(config *models.DeviceConfig) *models.ErrorResponse {
+	ports := []struct {
+		name  string
+		value int
+	}{
+		{"port", config.Port},
+		{"reload_port", config.ReloadPort},
+	}
+	for _, port := range ports {
+		if port.value < 1 || port.value > 65535 {
+			return &models.ErrorResponse{
+				Error:    "invalid_port",
+				DeviceID: config.DeviceID,
+				Message:  fmt.Sprintf("%s must be between 1 and 65535: %d", port.name, port.value),
+			}
+		}
+	}
+	return nil
+}
+
 // GetConfig handles GET /config/:device_id
 func GetConfig(c *gin.Context) {
 	deviceID := c.Param("device_id")
@@ -44,25 +70,31 @@ func GetConfig(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Returning config for %s: %s", deviceID, config.DeviceType)
-
-	// Build response without device_id field (as per API spec)
-	response := gin.H{
-		"device_type": config.DeviceType,
-		"port":        config.Port,
-		"reload_port": config.ReloadPort,
+	// The ETag changes with every write (and with changes to the device's profiles)
+	etag := configETag(config.Version)
+	c.Header("ETag", etag)
+	if inm := c.GetHeader("If-None-Match"); inm != "" && etagListMatches(inm, etag) {
+		c.Status(http.StatusNotModified)
+		return
 	}
 
-	if len(config.EnabledMetrics) > 0 {
-		response["enabled_metrics"] = config.EnabledMetrics
+	// Merge profiles unless the stored config is requested (?raw=true)
+	if c.Query("raw") != "true" {
+		config, err = effectiveConfig(config)
+		if err != nil {
+			log.Printf("Error merging profiles for %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to fetch device profiles",
+			})
+			return
+		}
 	}
 
-	// Spread extra_config into response (e.g., "shelly": {...}, "jetson": {...})
-	for key, value := range config.ExtraConfig {
-		response[key] = value
-	}
+	log.Printf("Returning config for %s: %s", deviceID, config.DeviceType)
 
-	c.JSON(http.StatusOK, response)
+	// Build response without device_id field (as per API spec)
+	c.JSON(http.StatusOK, exporterConfigMap(c, config))
 }
 
 // UpdateConfig handles PUT /config/:device_id
@@ -82,7 +114,9 @@ func UpdateConfig(c *gin.Context) {
 	}
 
 	// Build DeviceConfig from raw data
-	config := models.DeviceConfig{}
+	config := models.DeviceConfig{
+		DeviceID: deviceID,
+	}
 
 	if deviceType, ok := rawData["device_type"].(string); ok {
 		config.DeviceType = deviceType
@@ -117,6 +151,8 @@ func UpdateConfig(c *gin.Context) {
 		"reload_port":     true,
 		"enabled_metrics": true,
 		"ip_address":      true,
+		"labels":          true,
+		"profiles":        true,
 	}
 
 	config.ExtraConfig = make(map[string]interface{})
@@ -126,12 +162,61 @@ func UpdateConfig(c *gin.Context) {
 		}
 	}
 
+	// Labels are replaced when provided, otherwise kept
+	if val, exists := rawData["labels"]; exists {
+		deviceLabels, err := parseLabels(val)
+		if err != nil {
+			respondInvalidLabels(c, err)
+			return
+		}
+		config.Labels = deviceLabels
+	}
+
+	// Profiles are replaced when provided, otherwise kept
+	if val, exists := rawData["profiles"]; exists {
+		profiles, errResp := parseProfiles(val)
+		if errResp != nil {
+			c.JSON(errorResponseStatus(errResp), errResp)
+			return
+		}
+		config.Profiles = profiles
+	}
+
+	current, err := repository.GetByDeviceID(deviceID)
+	if err != nil {
+		log.Printf("Error fetching device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device",
+		})
+		return
+	}
+
+	ifVersion, ok := checkIfMatch(c, deviceID, current)
+	if !ok {
+		return
+	}
+
+	// Redacted secret values sent back unchanged keep their stored values
+	if current != nil {
+		config.ExtraConfig = secrets.Restore(config.ExtraConfig, current.ExtraConfig)
+	}
+
+	// New devices get the defaults of their device type template
+	if current == nil {
+		applyTemplate(&config, rawData)
+	}
+
+	if !validateEnabledMetrics(c, &config) {
+		return
+	}
+
 	// Set defaults if not provided
 	if config.Port == 0 {
-		config.Port = 9100
+		config.Port = defaultPort
 	}
 	if config.ReloadPort == 0 {
-		config.ReloadPort = 9101
+		config.ReloadPort = defaultReloadPort
 	}
 
 	// Handle IP address: if provided, validate it; otherwise preserve existing
@@ -141,8 +226,8 @@ func UpdateConfig(c *gin.Context) {
 
 	// If no IP provided, preserve existing IP
 	if config.IPAddress == "" {
-		if existing, _ := repository.GetByDeviceID(deviceID); existing != nil {
-			config.IPAddress = existing.IPAddress
+		if current != nil {
+			config.IPAddress = current.IPAddress
 		}
 	} else {
 		// If IP provided, validate it
@@ -155,7 +240,26 @@ func UpdateConfig(c *gin.Context) {
 		}
 	}
 
-	created, err := repository.Upsert(deviceID, &config)
+	if errResp := checkPorts(&config); errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	if !validateExtraConfig(c, &config) {
+		return
+	}
+
+	// With If-Match the device must still have the matched version
+	created := false
+	if ifVersion > 0 {
+		err = repository.UpdateIfVersion(deviceID, &config, ifVersion)
+	} else {
+		created, err = repository.Upsert(deviceID, &config)
+	}
+	if err == repository.ErrVersionConflict || (ifVersion > 0 && err == sql.ErrNoRows) {
+		respondPreconditionFailed(c, deviceID, 0)
+		return
+	}
 	if err != nil {
 		log.Printf("Error upserting config for %s: %v", deviceID, err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
@@ -173,17 +277,34 @@ func UpdateConfig(c *gin.Context) {
 		log.Printf("Updated config for device: %s", deviceID)
 	}
 
-	// Trigger reload on exporter if IP is available
-	reloadTriggered := false
-	if config.IPAddress != "" {
-		reloadTriggered = TriggerDeviceReloadWithLogging(deviceID, config)
+	recordRevision(&config, "update")
+	notifyConfigChanged(config.DeviceID)
+
+	if current != nil && config.IPAddress != current.IPAddress {
+		changed := config
+		changed.ApprovalStatus = current.ApprovalStatus
+		onIPChanged(&changed, current.IPAddress, "update")
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	// Queue a reload of the exporter if IP is available
+	reloadTriggered, reloadStatus := queueReload(c.Request.Context(), config, "update")
+
+	response := gin.H{
 		"status":           status,
 		"device_id":        deviceID,
 		"reload_triggered": reloadTriggered,
-	})
+	}
+	if reloadStatus != "" {
+		response["reload_status"] = reloadStatus
+	}
+	if created {
+		if token := issueDeviceToken(deviceID); token != "" {
+			response["device_token"] = token
+		}
+	}
+
+	c.Header("ETag", configETag(config.Version))
+	c.JSON(http.StatusOK, response)
 }
 
 // CreateConfig handles POST /config/:device_id
@@ -261,6 +382,8 @@ func CreateConfig(c *gin.Context) {
 		"reload_port":     true,
 		"enabled_metrics": true,
 		"ip_address":      true,
+		"labels":          true,
+		"profiles":        true,
 	}
 
 	config.ExtraConfig = make(map[string]interface{})
@@ -270,6 +393,25 @@ func CreateConfig(c *gin.Context) {
 		}
 	}
 
+	if val, exists := rawData["labels"]; exists {
+		deviceLabels, err := parseLabels(val)
+		if err != nil {
+			respondInvalidLabels(c, err)
+			return
+		}
+		config.Labels = deviceLabels
+	}
+
+	// Profiles are replaced when provided, otherwise kept
+	if val, exists := rawData["profiles"]; exists {
+		profiles, errResp := parseProfiles(val)
+		if errResp != nil {
+			c.JSON(errorResponseStatus(errResp), errResp)
+			return
+		}
+		config.Profiles = profiles
+	}
+
 	// Extract and validate IP address (required field)
 	if ipAddress, ok := rawData["ip_address"].(string); ok {
 		config.IPAddress = ipAddress
@@ -293,12 +435,20 @@ func CreateConfig(c *gin.Context) {
 		return
 	}
 
-	// Set defaults
-	if config.Port == 0 {
-		config.Port = 9100
+	// Fill ports, enabled_metrics and extra config blocks from the device type template
+	applyTemplate(&config, rawData)
+
+	if !validateEnabledMetrics(c, &config) {
+		return
 	}
-	if config.ReloadPort == 0 {
-		config.ReloadPort = 9101
+
+	if errResp := checkPorts(&config); errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	if !validateExtraConfig(c, &config) {
+		return
 	}
 
 	err = repository.Create(&config)
@@ -311,10 +461,15 @@ func CreateConfig(c *gin.Context) {
 		return
 	}
 
+	recordRevision(&config, "create")
+	notifyConfigChanged(config.DeviceID)
+
 	log.Printf("Created new device: %s", deviceID)
+	c.Header("ETag", configETag(config.Version))
 	c.JSON(http.StatusCreated, models.UpdateResponse{
-		Status:   "created",
-		DeviceID: deviceID,
+		Status:      "created",
+		DeviceID:    deviceID,
+		DeviceToken: issueDeviceToken(deviceID),
 	})
 }
 
@@ -323,7 +478,28 @@ func DeleteConfig(c *gin.Context) {
 	deviceID := c.Param("device_id")
 	log.Printf("Delete request for device: %s", deviceID)
 
-	err := repository.Delete(deviceID)
+	ifVersion := 0
+	if c.GetHeader("If-Match") != "" {
+		current, err := repository.GetByDeviceID(deviceID)
+		if err != nil {
+			log.Printf("Error fetching device %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to fetch device",
+			})
+			return
+		}
+		var ok bool
+		if ifVersion, ok = checkIfMatch(c, deviceID, current); !ok {
+			return
+		}
+	}
+
+	err := repository.DeleteIfVersion(deviceID, ifVersion)
+	if err == repository.ErrVersionConflict || (ifVersion > 0 && err == sql.ErrNoRows) {
+		respondPreconditionFailed(c, deviceID, 0)
+		return
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("Device not found for delete: %s", deviceID)
@@ -341,6 +517,17 @@ func DeleteConfig(c *gin.Context) {
 		return
 	}
 
+	if err := repository.DeleteHealth(deviceID); err != nil {
+		log.Printf("Error deleting cached health for %s: %v", deviceID, err)
+	}
+	if err := repository.DeleteSyncState(deviceID); err != nil {
+		log.Printf("Error deleting sync state for %s: %v", deviceID, err)
+	}
+	if err := repository.DeleteDeviceCredential(deviceID); err != nil {
+		log.Printf("Error deleting credential for %s: %v", deviceID, err)
+	}
+	notifyConfigChanged(deviceID)
+
 	log.Printf("Deleted device: %s", deviceID)
 	c.JSON(http.StatusOK, models.UpdateResponse{
 		Status:   "deleted",
@@ -371,21 +558,43 @@ func ListDevices(c *gin.Context) {
 		return
 	}
 
-	// Check health status of each device
-	var deviceStatuses []models.DeviceStatus
-	healthy := 0
-	unhealthy := 0
+	// Optional label selector (e.g. ?selector=site=lab2,rack!=r1)
+	selector, ok := parseSelectorQuery(c)
+	if !ok {
+		return
+	}
+	devices = filterBySelector(devices, selector)
 
-	for _, device := range devices {
-		status := CheckDeviceHealth(device)
+	// Optional filter by approval status (e.g. ?approval_status=pending)
+	if approvalStatus := c.Query("approval_status"); approvalStatus != "" {
+		filtered := make([]models.DeviceConfig, 0)
+		for _, device := range devices {
+			if device.ApprovalStatus == approvalStatus {
+				filtered = append(filtered, device)
+			}
+		}
+		devices = filtered
+	}
+
+	// Read health status of each device from the health cache (or check live with ?refresh=true)
+	deviceStatuses, err := loadDeviceStatuses(c, devices)
+	if err != nil {
+		log.Printf("Error fetching device health: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device health",
+		})
+		return
+	}
 
+	healthy := 0
+	unhealthy := 0
+	for _, status := range deviceStatuses {
 		if status.Status == "healthy" {
 			healthy++
 		} else {
 			unhealthy++
 		}
-
-		deviceStatuses = append(deviceStatuses, status)
 	}
 
 	c.JSON(http.StatusOK, models.DevicesListResponse{
@@ -451,7 +660,7 @@ func ReloadDevice(c *gin.Context) {
 	if !success {
 		log.Printf("Failed to trigger reload for %s: %s", deviceID, errMsg)
 		statusCode := http.StatusServiceUnavailable
-		if errMsg == "No IP address" {
+		if errMsg == exporter.ErrNoIPAddress {
 			statusCode = http.StatusBadRequest
 		} else if errMsg[:4] == "HTTP" {
 			statusCode = http.StatusBadGateway
@@ -485,39 +694,87 @@ func ReloadAllDevices(c *gin.Context) {
 		return
 	}
 
+	results, success, failed := reloadDevices(c.Request.Context(), devices, "")
+
+	log.Printf("Reload all: %d success, %d failed", success, failed)
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"total":   len(devices),
+		"success": success,
+		"failed":  failed,
+	})
+}
+
+// reloadDevices triggers reloads on devices in parallel
+// With a reason the reloads are queued in the reload outbox first, so failed
+// deliveries are retried in the background ("retrying": true in the result);
+// without one each device is sent a single reload request.
+// Results keep the device order; devices without an IP address are skipped
+func reloadDevices(ctx context.Context, devices []models.DeviceConfig, reason string) ([]gin.H, int, int) {
+	jobIDs := make([]int64, len(devices))
+	if reason != "" {
+		for i, device := range devices {
+			if device.IPAddress == "" {
+				continue
+			}
+			id, err := exporter.Enqueue(device.DeviceID, reason)
+			if err != nil {
+				log.Printf("Error queueing reload of %s: %v", device.DeviceID, err)
+				continue
+			}
+			jobIDs[i] = id
+		}
+	}
+
+	reloads := make([]exporter.ReloadResult, len(devices))
+	jobStatuses := make([]string, len(devices))
+	started := fanout.Run(ctx, len(devices), func(ctx context.Context, i int) {
+		if jobIDs[i] != 0 {
+			reloads[i], jobStatuses[i] = exporter.Deliver(ctx, jobIDs[i])
+			return
+		}
+		reloads[i] = exporter.Reload(ctx, devices[i])
+	})
+
 	results := make([]gin.H, 0)
 	success := 0
 	failed := 0
 
-	for _, device := range devices {
+	for i, device := range devices {
 		result := gin.H{
 			"device_id": device.DeviceID,
 		}
 
-		reloadSuccess, errMsg := TriggerDeviceReload(device)
+		if !started[i] {
+			reloads[i] = exporter.ReloadResult{Error: "reload deadline exceeded"}
+			if jobIDs[i] != 0 {
+				jobStatuses[i] = models.ReloadPending // Left to the outbox worker
+			}
+		} else if device.IPAddress != "" {
+			result["latency_ms"] = reloads[i].LatencyMs
+		}
+
+		reloadSuccess, errMsg := reloads[i].Success, reloads[i].Error
 		if reloadSuccess {
 			result["status"] = "reloaded"
 			success++
 		} else {
-			if errMsg == "No IP address" {
+			if errMsg == exporter.ErrNoIPAddress {
 				result["status"] = "skipped"
 			} else {
 				result["status"] = "failed"
 			}
 			result["error"] = errMsg
+			if jobStatuses[i] == models.ReloadPending {
+				result["retrying"] = true
+			}
 			failed++
 		}
 
 		results = append(results, result)
 	}
 
-	log.Printf("Reload all: %d success, %d failed", success, failed)
-	c.JSON(http.StatusOK, gin.H{
-		"results": results,
-		"total":   len(devices),
-		"success": success,
-		"failed":  failed,
-	})
+	return results, success, failed
 }
 
 // ListConfigs handles GET /config
@@ -534,23 +791,35 @@ func ListConfigs(c *gin.Context) {
 		return
 	}
 
+	// Optional label selector (e.g. ?selector=site=lab2,rack!=r1)
+	selector, ok := parseSelectorQuery(c)
+	if !ok {
+		return
+	}
+	devices = filterBySelector(devices, selector)
+
+	// Merge profiles unless the stored configs are requested (?raw=true)
+	raw := c.Query("raw") == "true"
+
 	configs := make([]gin.H, 0)
 	for _, device := range devices {
-		config := gin.H{
-			"device_id":   device.DeviceID,
-			"device_type": device.DeviceType,
-			"port":        device.Port,
-			"reload_port": device.ReloadPort,
-		}
-
-		if len(device.EnabledMetrics) > 0 {
-			config["enabled_metrics"] = device.EnabledMetrics
+		effective := &device
+		if !raw {
+			effective, err = effectiveConfig(&device)
+			if err != nil {
+				log.Printf("Error merging profiles for %s: %v", device.DeviceID, err)
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+					Error:   "Internal server error",
+					Message: "Failed to fetch device profiles",
+				})
+				return
+			}
 		}
 
-		// Spread extra_config
-		for key, value := range device.ExtraConfig {
-			config[key] = value
-		}
+		config := gin.H(secrets.Redact(configToMap(effective)))
+		config["device_id"] = device.DeviceID
+		config["labels"] = device.Labels
+		config["profiles"] = device.Profiles
 
 		configs = append(configs, config)
 	}
@@ -566,26 +835,6 @@ func PatchConfig(c *gin.Context) {
 	deviceID := c.Param("device_id")
 	log.Printf("Patch request for device: %s", deviceID)
 
-	// Check if device exists
-	existing, err := repository.GetByDeviceID(deviceID)
-	if err != nil {
-		log.Printf("Error fetching device %s: %v", deviceID, err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Internal server error",
-			Message: "Failed to fetch device",
-		})
-		return
-	}
-
-	if existing == nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error:    "Device not found",
-			DeviceID: deviceID,
-			Message:  "Use POST or PUT to create new device",
-		})
-		return
-	}
-
 	// Parse patch data
 	var patchData map[string]interface{}
 	if err := c.ShouldBindJSON(&patchData); err != nil {
@@ -596,8 +845,98 @@ func PatchConfig(c *gin.Context) {
 		return
 	}
 
-	// Apply patches to existing config
-	// null values will reset fields to defaults or remove them
+	// The patch is saved only if the device is unchanged since it was read.
+	// Without If-Match a concurrent write is retried on the new version.
+	var existing *models.DeviceConfig
+	var oldIP string
+	for attempt := 1; ; attempt++ {
+		var err error
+		existing, err = repository.GetByDeviceID(deviceID)
+		if err != nil {
+			log.Printf("Error fetching device %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to fetch device",
+			})
+			return
+		}
+
+		if existing == nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:    "Device not found",
+				DeviceID: deviceID,
+				Message:  "Use POST or PUT to create new device",
+			})
+			return
+		}
+
+		if _, ok := checkIfMatch(c, deviceID, existing); !ok {
+			return
+		}
+
+		oldIP = existing.IPAddress
+		if errResp := applyConfigPatch(existing, patchData); errResp != nil {
+			c.JSON(errorResponseStatus(errResp), errResp)
+			return
+		}
+
+		// Save updated config
+		err = repository.UpdateIfVersion(deviceID, existing, existing.Version)
+		if err == repository.ErrVersionConflict || err == sql.ErrNoRows {
+			if c.GetHeader("If-Match") != "" {
+				respondPreconditionFailed(c, deviceID, 0)
+				return
+			}
+			if attempt < maxPatchAttempts {
+				log.Printf("Config of %s changed during patch, retrying", deviceID)
+				continue
+			}
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error:    "concurrent_modification",
+				DeviceID: deviceID,
+				Message:  "Config kept changing while patching, retry the request",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Error updating config for %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to update device configuration",
+			})
+			return
+		}
+		break
+	}
+
+	recordRevision(existing, "patch")
+	notifyConfigChanged(existing.DeviceID)
+
+	if existing.IPAddress != oldIP {
+		onIPChanged(existing, oldIP, "patch")
+	}
+
+	// Queue a reload of the exporter if IP is available
+	reloadTriggered, reloadStatus := queueReload(c.Request.Context(), *existing, "patch")
+
+	response := gin.H{
+		"status":           "patched",
+		"device_id":        deviceID,
+		"reload_triggered": reloadTriggered,
+	}
+	if reloadStatus != "" {
+		response["reload_status"] = reloadStatus
+	}
+
+	log.Printf("Patched config for device: %s", deviceID)
+	c.Header("ETag", configETag(existing.Version))
+	c.JSON(http.StatusOK, response)
+}
+
+// applyConfigPatch applies a JSON merge patch to a device config
+// null values reset fields to defaults or remove them
+// Returns the error response if the patched config is invalid
+func applyConfigPatch(existing *models.DeviceConfig, patchData map[string]interface{}) *models.ErrorResponse {
 	if val, exists := patchData["device_type"]; exists {
 		if val == nil {
 			existing.DeviceType = ""
@@ -605,16 +944,38 @@ func PatchConfig(c *gin.Context) {
 			existing.DeviceType = s
 		}
 	}
+
+	// Profiles are replaced (null removes all profiles)
+	if val, exists := patchData["profiles"]; exists {
+		profiles, errResp := parseProfiles(val)
+		if errResp != nil {
+			return errResp
+		}
+		existing.Profiles = profiles
+	}
+
+	// Fields reset to null fall back to the device type template, then to server defaults
+	template := templateFor(existing.DeviceType)
+	if template == nil {
+		template = &models.DeviceTemplate{}
+	}
+
 	if val, exists := patchData["port"]; exists {
 		if val == nil {
-			existing.Port = 9100 // default
+			existing.Port = defaultPort
+			if template.Port != 0 {
+				existing.Port = template.Port
+			}
 		} else if f, ok := val.(float64); ok {
 			existing.Port = int(f)
 		}
 	}
 	if val, exists := patchData["reload_port"]; exists {
 		if val == nil {
-			existing.ReloadPort = 9101 // default
+			existing.ReloadPort = defaultReloadPort
+			if template.ReloadPort != 0 {
+				existing.ReloadPort = template.ReloadPort
+			}
 		} else if f, ok := val.(float64); ok {
 			existing.ReloadPort = int(f)
 		}
@@ -622,6 +983,9 @@ func PatchConfig(c *gin.Context) {
 	if val, exists := patchData["enabled_metrics"]; exists {
 		if val == nil {
 			existing.EnabledMetrics = nil
+			if len(existing.Profiles) == 0 && len(template.EnabledMetrics) > 0 {
+				existing.EnabledMetrics = append([]string(nil), template.EnabledMetrics...)
+			}
 		} else if metrics, ok := val.([]interface{}); ok {
 			existing.EnabledMetrics = nil
 			for _, m := range metrics {
@@ -639,11 +1003,10 @@ func PatchConfig(c *gin.Context) {
 		} else if s, ok := val.(string); ok {
 			// Validate IP before updating
 			if !isValidIP(s) {
-				c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				return &models.ErrorResponse{
 					Error:   "invalid_ip_address",
 					Message: fmt.Sprintf("Invalid IP address format: %s", s),
-				})
-				return
+				}
 			}
 			existing.IPAddress = s
 		}
@@ -656,6 +1019,8 @@ func PatchConfig(c *gin.Context) {
 		"reload_port":     true,
 		"enabled_metrics": true,
 		"ip_address":      true,
+		"labels":          true,
+		"profiles":        true,
 	}
 
 	if existing.ExtraConfig == nil {
@@ -665,37 +1030,55 @@ func PatchConfig(c *gin.Context) {
 	for key, value := range patchData {
 		if !standardFields[key] {
 			if value == nil {
-				// Remove the key if value is null
-				delete(existing.ExtraConfig, key)
+				// Reset the block to the template, or remove the key
+				if block, ok := template.ExtraConfig[key]; ok && len(existing.Profiles) == 0 {
+					existing.ExtraConfig[key] = block
+				} else {
+					delete(existing.ExtraConfig, key)
+				}
 			} else {
-				existing.ExtraConfig[key] = value
+				existing.ExtraConfig[key] = secrets.RestoreValue(key, value, existing.ExtraConfig[key])
 			}
 		}
 	}
 
-	// Save updated config
-	err = repository.Update(deviceID, existing)
-	if err != nil {
-		log.Printf("Error updating config for %s: %v", deviceID, err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Internal server error",
-			Message: "Failed to update device configuration",
-		})
-		return
+	if errResp := checkPorts(existing); errResp != nil {
+		return errResp
 	}
 
-	// Trigger reload
-	reloadTriggered := false
-	if existing.IPAddress != "" {
-		reloadTriggered = TriggerDeviceReloadWithLogging(deviceID, *existing)
+	if errResp := checkEnabledMetrics(existing); errResp != nil {
+		return errResp
 	}
 
-	log.Printf("Patched config for device: %s", deviceID)
-	c.JSON(http.StatusOK, gin.H{
-		"status":           "patched",
-		"device_id":        deviceID,
-		"reload_triggered": reloadTriggered,
-	})
+	// Validate the patched blocks (all blocks if the device type or profiles change)
+	var blocks []string
+	_, typeChanged := patchData["device_type"]
+	_, profilesChanged := patchData["profiles"]
+	if !typeChanged && !profilesChanged {
+		blocks = []string{}
+		for key := range patchData {
+			if !standardFields[key] {
+				blocks = append(blocks, key)
+			}
+		}
+	}
+	if errResp := checkExtraConfig(existing, blocks); errResp != nil {
+		return errResp
+	}
+
+	// Labels are merged (null values remove keys)
+	if val, exists := patchData["labels"]; exists {
+		deviceLabels, err := patchLabels(existing.Labels, val)
+		if err != nil {
+			return &models.ErrorResponse{
+				Error:   "invalid_labels",
+				Message: err.Error(),
+			}
+		}
+		existing.Labels = deviceLabels
+	}
+
+	return nil
 }
 
 // GetMetricsSummary handles GET /metrics/summary
@@ -712,32 +1095,28 @@ func GetMetricsSummary(c *gin.Context) {
 		return
 	}
 
+	deviceStatuses, err := loadDeviceStatuses(c, devices)
+	if err != nil {
+		log.Printf("Error fetching device health: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device health",
+		})
+		return
+	}
+
 	// Count by device type
 	typeCount := make(map[string]int)
 	healthy := 0
 	unhealthy := 0
 
-	client := &http.Client{Timeout: 2 * time.Second}
-
-	for _, device := range devices {
-		typeCount[device.DeviceType]++
+	for _, status := range deviceStatuses {
+		typeCount[status.DeviceType]++
 
-		// Check health
-		if device.IPAddress == "" {
-			unhealthy++
+		if status.Status == "healthy" {
+			healthy++
 		} else {
-			healthURL := fmt.Sprintf("http://%s:%d/health", device.IPAddress, device.ReloadPort)
-			resp, err := client.Get(healthURL)
-			if err != nil {
-				unhealthy++
-			} else {
-				resp.Body.Close()
-				if resp.StatusCode == http.StatusOK {
-					healthy++
-				} else {
-					unhealthy++
-				}
-			}
+			unhealthy++
 		}
 	}
 
@@ -786,8 +1165,21 @@ func GetDeviceLocalConfig(c *gin.Context) {
 	configURL := fmt.Sprintf("http://%s:%d/config", device.IPAddress, device.ReloadPort)
 	log.Printf("Fetching local config from: %s", configURL)
 
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, configURL, nil)
+	if err == nil {
+		err = exporter.Sign(req, deviceID, nil)
+	}
+	if err != nil {
+		log.Printf("Error building local config request for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to build device request",
+		})
+		return
+	}
+
 	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(configURL)
+	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Failed to fetch local config from %s: %v", configURL, err)
 		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
@@ -809,41 +1201,28 @@ func GetDeviceLocalConfig(c *gin.Context) {
 		return
 	}
 
-	// Proxy the response
-	c.Header("Content-Type", "application/json")
-	c.Status(http.StatusOK)
-	_, err = io.Copy(c.Writer, resp.Body)
-	if err != nil {
-		log.Printf("Error copying response body: %v", err)
+	// Proxy the response with secret values redacted (the exporter runs with them decrypted)
+	var localConfig map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&localConfig); err != nil {
+		log.Printf("Invalid local config from %s: %v", configURL, err)
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error:    "Device error",
+			DeviceID: deviceID,
+			Message:  "Device returned an invalid config",
+		})
+		return
 	}
+
+	c.JSON(http.StatusOK, secrets.Redact(localConfig))
 }
 
 // PatchDevice handles PATCH /devices/:device_id
-// Updates only basic device information (device_type, ip_address, port, reload_port)
-// Does NOT trigger reload on the device
+// Updates only basic device information (device_type, ip_address, port, reload_port, labels)
+// Does NOT trigger reload on the device. If-Match is handled like PATCH /config/:device_id
 func PatchDevice(c *gin.Context) {
 	deviceID := c.Param("device_id")
 	log.Printf("Patch device basic info request for: %s", deviceID)
 
-	// Check if device exists
-	existing, err := repository.GetByDeviceID(deviceID)
-	if err != nil {
-		log.Printf("Error fetching device %s: %v", deviceID, err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Internal server error",
-			Message: "Failed to fetch device",
-		})
-		return
-	}
-
-	if existing == nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error:    "Device not found",
-			DeviceID: deviceID,
-		})
-		return
-	}
-
 	// Parse patch data
 	var patchData map[string]interface{}
 	if err := c.ShouldBindJSON(&patchData); err != nil {
@@ -854,7 +1233,91 @@ func PatchDevice(c *gin.Context) {
 		return
 	}
 
-	// Apply patches - only allow device_type, ip_address, port, reload_port
+	// Like PATCH /config/:device_id, the patch is saved only if the device is
+	// unchanged since it was read, and retried on the new version without If-Match
+	var existing *models.DeviceConfig
+	var oldIP string
+	for attempt := 1; ; attempt++ {
+		var err error
+		existing, err = repository.GetByDeviceID(deviceID)
+		if err != nil {
+			log.Printf("Error fetching device %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to fetch device",
+			})
+			return
+		}
+
+		if existing == nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:    "Device not found",
+				DeviceID: deviceID,
+			})
+			return
+		}
+
+		if _, ok := checkIfMatch(c, deviceID, existing); !ok {
+			return
+		}
+
+		oldIP = existing.IPAddress
+		if errResp := applyDevicePatch(existing, patchData); errResp != nil {
+			c.JSON(errorResponseStatus(errResp), errResp)
+			return
+		}
+
+		// Save updated config
+		err = repository.UpdateIfVersion(deviceID, existing, existing.Version)
+		if err == repository.ErrVersionConflict || err == sql.ErrNoRows {
+			if c.GetHeader("If-Match") != "" {
+				respondPreconditionFailed(c, deviceID, 0)
+				return
+			}
+			if attempt < maxPatchAttempts {
+				log.Printf("Device %s changed during patch, retrying", deviceID)
+				continue
+			}
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error:    "concurrent_modification",
+				DeviceID: deviceID,
+				Message:  "Config kept changing while patching, retry the request",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Error updating device %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to update device",
+			})
+			return
+		}
+		break
+	}
+
+	recordRevision(existing, "patch_device")
+	notifyConfigChanged(existing.DeviceID)
+
+	if existing.IPAddress != oldIP {
+		onIPChanged(existing, oldIP, "patch_device")
+	}
+
+	log.Printf("Updated basic info for device: %s (reload NOT triggered)", deviceID)
+	c.Header("ETag", configETag(existing.Version))
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "updated",
+		"device_id": deviceID,
+		"message":   "Device basic information updated (reload not triggered)",
+	})
+}
+
+// applyDevicePatch applies a PATCH /devices/:device_id body to a device config
+// Only device_type, ip_address, port, reload_port and labels are patched.
+// Returns the error response if the patched config is invalid
+func applyDevicePatch(existing *models.DeviceConfig, patchData map[string]interface{}) *models.ErrorResponse {
+	oldType := existing.DeviceType
+
 	if val, exists := patchData["device_type"]; exists {
 		if s, ok := val.(string); ok && s != "" {
 			existing.DeviceType = s
@@ -864,19 +1327,17 @@ func PatchDevice(c *gin.Context) {
 	if val, exists := patchData["ip_address"]; exists {
 		if s, ok := val.(string); ok {
 			if s == "" {
-				c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				return &models.ErrorResponse{
 					Error:   "invalid_ip_address",
 					Message: "IP address cannot be empty",
-				})
-				return
+				}
 			}
 			// Validate IP before updating
 			if !isValidIP(s) {
-				c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				return &models.ErrorResponse{
 					Error:   "invalid_ip_address",
 					Message: fmt.Sprintf("Invalid IP address format: %s", s),
-				})
-				return
+				}
 			}
 			existing.IPAddress = s
 		}
@@ -894,24 +1355,33 @@ func PatchDevice(c *gin.Context) {
 		}
 	}
 
+	if val, exists := patchData["labels"]; exists {
+		deviceLabels, err := patchLabels(existing.Labels, val)
+		if err != nil {
+			return &models.ErrorResponse{
+				Error:   "invalid_labels",
+				Message: err.Error(),
+			}
+		}
+		existing.Labels = deviceLabels
+	}
+
 	// Ignore any other fields (enabled_metrics, extra_config, etc.)
 
-	// Save updated config
-	err = repository.Update(deviceID, existing)
-	if err != nil {
-		log.Printf("Error updating device %s: %v", deviceID, err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Internal server error",
-			Message: "Failed to update device",
-		})
-		return
+	if errResp := checkPorts(existing); errResp != nil {
+		return errResp
 	}
 
-	log.Printf("Updated basic info for device: %s (reload NOT triggered)", deviceID)
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "updated",
-		"device_id": deviceID,
-		"message":   "Device basic information updated (reload not triggered)",
-	})
+	// The stored config must stay valid for a new device type
+	if existing.DeviceType != oldType {
+		if errResp := checkEnabledMetrics(existing); errResp != nil {
+			return errResp
+		}
+		if errResp := checkExtraConfig(existing, nil); errResp != nil {
+			return errResp
+		}
+	}
+
+	return nil
 }
 
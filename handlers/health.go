@@ -1,89 +1,32 @@
 package handlers
 
 import (
+	"context"
+	"edge-metrics-server/exporter"
+	"edge-metrics-server/health"
 	"edge-metrics-server/models"
-	"fmt"
-	"log"
-	"net/http"
-	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
-// CheckDeviceHealth checks device health and returns detailed status
+// CheckDeviceHealth checks device health on demand and returns detailed status
+// The result is also written to the health cache
 func CheckDeviceHealth(device models.DeviceConfig) models.DeviceStatus {
-	status := models.DeviceStatus{
-		DeviceID:   device.DeviceID,
-		DeviceType: device.DeviceType,
-		IPAddress:  device.IPAddress,
-		Port:       device.Port,
-		ReloadPort: device.ReloadPort,
-	}
-
-	// Check if IP address is available
-	if device.IPAddress == "" || device.IPAddress == "unknown" {
-		status.Status = "unknown"
-		if device.IPAddress == "" {
-			status.Error = "No IP address registered"
-		}
-		return status
-	}
-
-	// Perform health check
-	healthURL := fmt.Sprintf("http://%s:%d/health", device.IPAddress, device.ReloadPort)
-	client := &http.Client{Timeout: 2 * time.Second}
-
-	resp, err := client.Get(healthURL)
-	if err != nil {
-		status.Status = "unreachable"
-		status.Error = err.Error()
-		return status
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusOK {
-		status.Status = "healthy"
-		status.LastSeen = time.Now().Format(time.RFC3339)
-	} else {
-		status.Status = "unhealthy"
-		status.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
-	}
-
-	return status
+	return health.Check(device)
 }
 
-// IsDeviceHealthy returns true if device is healthy
-func IsDeviceHealthy(device models.DeviceConfig) bool {
-	return CheckDeviceHealth(device).Status == "healthy"
+// loadDeviceStatuses returns the health of each device from the health cache,
+// or checks all devices in parallel when ?refresh=true is set
+func loadDeviceStatuses(c *gin.Context, devices []models.DeviceConfig) ([]models.DeviceStatus, error) {
+	if c.Query("refresh") == "true" {
+		return health.CheckAll(c.Request.Context(), devices), nil
+	}
+	return health.CachedStatuses(devices)
 }
 
 // TriggerDeviceReload sends a reload request to a device
 // Returns (success bool, error string)
 func TriggerDeviceReload(device models.DeviceConfig) (bool, string) {
-	if device.IPAddress == "" {
-		return false, "No IP address"
-	}
-
-	reloadURL := fmt.Sprintf("http://%s:%d/reload", device.IPAddress, device.ReloadPort)
-	client := &http.Client{Timeout: 2 * time.Second}
-
-	resp, err := client.Post(reloadURL, "application/json", nil)
-	if err != nil {
-		return false, err.Error()
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusOK {
-		return true, ""
-	}
-	return false, fmt.Sprintf("HTTP %d", resp.StatusCode)
-}
-
-// TriggerDeviceReloadWithLogging triggers reload and logs the result
-func TriggerDeviceReloadWithLogging(deviceID string, device models.DeviceConfig) bool {
-	success, errMsg := TriggerDeviceReload(device)
-	if !success {
-		log.Printf("Failed to trigger reload for %s: %s", deviceID, errMsg)
-	} else {
-		log.Printf("Reload triggered for device: %s", deviceID)
-	}
-	return success
+	result := exporter.Reload(context.Background(), device)
+	return result.Success, result.Error
 }
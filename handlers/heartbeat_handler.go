@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"edge-metrics-server/kubernetes"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeartbeatRequest represents the (optional) request body of a heartbeat
+type HeartbeatRequest struct {
+	IPAddress string `json:"ip_address"`
+}
+
+// DeviceHeartbeat handles POST /devices/:device_id/heartbeat
+// The reported IP (or the request's remote address) is compared with the
+// registered one and applied if it changed
+func DeviceHeartbeat(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	log.Printf("Heartbeat from device: %s", deviceID)
+
+	var req HeartbeatRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	device, err := repository.GetByDeviceID(deviceID)
+	if err != nil {
+		log.Printf("Error fetching device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device",
+		})
+		return
+	}
+
+	if device == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:    "Device not found",
+			DeviceID: deviceID,
+		})
+		return
+	}
+
+	observedIP := req.IPAddress
+	if observedIP == "" {
+		observedIP = c.ClientIP()
+	}
+	if !isValidIP(observedIP) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:    "invalid_ip_address",
+			DeviceID: deviceID,
+			Message:  fmt.Sprintf("Invalid IP address format: %s", observedIP),
+		})
+		return
+	}
+
+	changed, endpointsUpdated, err := applyObservedIP(device, observedIP, "heartbeat")
+	if err != nil {
+		log.Printf("Error updating IP address for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to update device IP address",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":            "ok",
+		"device_id":         deviceID,
+		"ip_address":        device.IPAddress,
+		"ip_changed":        changed,
+		"endpoints_updated": endpointsUpdated,
+	})
+}
+
+// GetDeviceEvents handles GET /devices/:device_id/events
+func GetDeviceEvents(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	log.Printf("List events request for device: %s", deviceID)
+
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_limit",
+				Message: "Query parameter 'limit' must be a positive number",
+			})
+			return
+		}
+		limit = n
+	}
+
+	events, err := repository.GetEvents(deviceID, limit)
+	if err != nil {
+		log.Printf("Error fetching events for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device events",
+		})
+		return
+	}
+
+	if events == nil {
+		events = []models.DeviceEvent{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"events":    events,
+		"total":     len(events),
+	})
+}
+
+// applyObservedIP saves a newly observed IP address for a device if it differs
+// from the registered one, then runs the IP change side effects (see onIPChanged)
+// device is updated in place. Returns (ip changed, endpoints updated, error)
+func applyObservedIP(device *models.DeviceConfig, observedIP, source string) (bool, bool, error) {
+	if device.IPAddress == observedIP {
+		return false, false, nil
+	}
+
+	oldIP := device.IPAddress
+	device.IPAddress = observedIP
+
+	if err := repository.Update(device.DeviceID, device); err != nil {
+		device.IPAddress = oldIP
+		return false, false, err
+	}
+
+	recordRevision(device, "ip_change")
+	notifyConfigChanged(device.DeviceID)
+
+	return true, onIPChanged(device, oldIP, source), nil
+}
+
+// onIPChanged records an IP change in the event log and points the device's
+// Kubernetes Endpoints at the new address (only if the device is already synced)
+// Returns true if the Endpoints object was updated
+func onIPChanged(device *models.DeviceConfig, oldIP, source string) bool {
+	log.Printf("IP address of %s changed: %s -> %s (%s)", device.DeviceID, oldIP, device.IPAddress, source)
+	recordEvent(&models.DeviceEvent{
+		DeviceID: device.DeviceID,
+		Type:     "ip_changed",
+		OldValue: oldIP,
+		NewValue: device.IPAddress,
+		Source:   source,
+	})
+
+	if !kubernetes.IsInitialized() || !device.IsApproved() {
+		return false
+	}
+
+	namespace := kubernetes.GetNamespace()
+	updated, err := kubernetes.RefreshEndpoints(namespace, device.DeviceID, device.IPAddress, device.Port)
+	if err != nil {
+		log.Printf("Failed to refresh endpoints for %s: %v", device.DeviceID, err)
+		recordEvent(&models.DeviceEvent{
+			DeviceID: device.DeviceID,
+			Type:     "endpoints_update_failed",
+			NewValue: device.IPAddress,
+			Source:   source,
+			Message:  err.Error(),
+		})
+		return false
+	}
+
+	if updated {
+		log.Printf("Refreshed endpoints for %s (%s)", device.DeviceID, device.IPAddress)
+		recordEvent(&models.DeviceEvent{
+			DeviceID: device.DeviceID,
+			Type:     "endpoints_updated",
+			OldValue: oldIP,
+			NewValue: device.IPAddress,
+			Source:   source,
+			Message:  fmt.Sprintf("namespace %s", namespace),
+		})
+	}
+	return updated
+}
+
+// recordEvent appends to the device event log and logs failures
+// The event log is best effort and never fails the request
+func recordEvent(event *models.DeviceEvent) {
+	if err := repository.CreateEvent(event); err != nil {
+		log.Printf("Failed to record %s event for %s: %v", event.Type, event.DeviceID, err)
+	}
+}
@@ -2,9 +2,10 @@ package handlers
 
 import (
 	"fmt"
+	"net"
 	"net/http"
-	"os"
 
+	"edge-metrics-server/health"
 	"edge-metrics-server/kubernetes"
 	"edge-metrics-server/models"
 	"edge-metrics-server/repository"
@@ -32,20 +33,14 @@ func SyncKubernetes(c *gin.Context) {
 
 	var req SyncKubernetesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		req.Namespace = "monitoring" // Default namespace
+		req.Namespace = kubernetes.GetNamespace() // Default namespace
 	}
 
 	if req.Namespace == "" {
-		req.Namespace = "monitoring"
+		req.Namespace = kubernetes.GetNamespace()
 	}
 
-	// Get server URL from environment or default
-	serverURL := os.Getenv("SERVER_URL")
-	if serverURL == "" {
-		serverURL = "http://localhost:8081"
-	}
-
-	result, err := kubernetes.SyncDevices(req.Namespace, serverURL)
+	result, err := kubernetes.SyncDevices(req.Namespace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Sync failed",
@@ -59,7 +54,7 @@ func SyncKubernetes(c *gin.Context) {
 
 // GetManifests handles GET /kubernetes/manifests
 func GetManifests(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "monitoring")
+	namespace := c.DefaultQuery("namespace", kubernetes.GetNamespace())
 
 	// Get all device configs
 	configs, err := repository.GetAll()
@@ -71,10 +66,19 @@ func GetManifests(c *gin.Context) {
 		return
 	}
 
-	// Check device health
+	// Check device health (from the health cache)
+	statuses, err := health.CachedStatuses(configs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get device health",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	var healthyDevices []models.DeviceConfig
-	for _, config := range configs {
-		if IsDeviceHealthy(config) {
+	for i, config := range configs {
+		if statuses[i].Status == "healthy" && config.IsApproved() {
 			healthyDevices = append(healthyDevices, config)
 		}
 	}
@@ -86,12 +90,49 @@ func GetManifests(c *gin.Context) {
 
 	// Generate YAML manifests
 	yaml := generateManifests(namespace, healthyDevices)
+
+	// Optionally append the Prometheus Operator monitors
+	if c.Query("include_monitors") == "true" {
+		monitors, err := generateMonitorsYAML(namespace)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to generate monitors",
+				"message": err.Error(),
+			})
+			return
+		}
+		yaml += monitors
+	}
+
 	c.Header("Content-Type", "text/plain")
 	c.String(http.StatusOK, yaml)
 }
 
-// GetKubernetesStatus handles GET /kubernetes/status
-func GetKubernetesStatus(c *gin.Context) {
+// GetMonitors handles GET /kubernetes/monitors
+// Returns the ServiceMonitor/ScrapeConfig objects generated from the scrape settings (YAML)
+func GetMonitors(c *gin.Context) {
+	namespace := c.DefaultQuery("namespace", kubernetes.GetNamespace())
+
+	yaml, err := generateMonitorsYAML(namespace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to generate monitors",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if yaml == "" {
+		c.String(http.StatusOK, "# No approved devices to generate monitors\n")
+		return
+	}
+
+	c.Header("Content-Type", "text/plain")
+	c.String(http.StatusOK, fmt.Sprintf("# Prometheus Operator %s objects for edge devices\n", kubernetes.GetMonitorKind())+yaml)
+}
+
+// SyncMonitors handles POST /kubernetes/monitors/sync
+func SyncMonitors(c *gin.Context) {
 	if !kubernetes.IsInitialized() {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"error":   "Kubernetes client not initialized",
@@ -100,14 +141,60 @@ func GetKubernetesStatus(c *gin.Context) {
 		return
 	}
 
-	namespace := c.DefaultQuery("namespace", "monitoring")
+	var req SyncKubernetesRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Namespace == "" {
+		req.Namespace = kubernetes.GetNamespace()
+	}
+
+	settings, err := repository.GetAllScrapeSettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get scrape settings",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	result, err := kubernetes.SyncMonitors(req.Namespace, settings)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Monitor sync failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
 
-	serverURL := os.Getenv("SERVER_URL")
-	if serverURL == "" {
-		serverURL = "http://localhost:8081"
+// generateMonitorsYAML renders the monitors for a namespace from the stored scrape settings
+func generateMonitorsYAML(namespace string) (string, error) {
+	settings, err := repository.GetAllScrapeSettings()
+	if err != nil {
+		return "", err
+	}
+
+	objects, err := kubernetes.BuildMonitors(namespace, settings)
+	if err != nil {
+		return "", err
+	}
+
+	return kubernetes.MonitorsToYAML(objects)
+}
+
+// GetKubernetesStatus handles GET /kubernetes/status
+func GetKubernetesStatus(c *gin.Context) {
+	if !kubernetes.IsInitialized() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Kubernetes client not initialized",
+			"message": "Server not running in Kubernetes environment or kubeconfig not found",
+		})
+		return
 	}
 
-	status, err := kubernetes.GetSyncStatus(namespace, serverURL)
+	namespace := c.DefaultQuery("namespace", kubernetes.GetNamespace())
+
+	status, err := kubernetes.GetSyncStatus(namespace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to get status",
@@ -130,14 +217,9 @@ func SyncSingleDevice(c *gin.Context) {
 	}
 
 	deviceID := c.Param("device_id")
-	namespace := c.DefaultQuery("namespace", "monitoring")
-
-	serverURL := os.Getenv("SERVER_URL")
-	if serverURL == "" {
-		serverURL = "http://localhost:8081"
-	}
+	namespace := c.DefaultQuery("namespace", kubernetes.GetNamespace())
 
-	result, err := kubernetes.SyncSingleDevice(namespace, deviceID, serverURL)
+	result, err := kubernetes.SyncSingleDevice(namespace, deviceID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Sync failed",
@@ -160,7 +242,7 @@ func GetDeviceResources(c *gin.Context) {
 	}
 
 	deviceID := c.Param("device_id")
-	namespace := c.DefaultQuery("namespace", "monitoring")
+	namespace := c.DefaultQuery("namespace", kubernetes.GetNamespace())
 
 	resources, err := kubernetes.GetDeviceResources(namespace, deviceID)
 	if err != nil {
@@ -185,7 +267,7 @@ func DeleteDeviceResources(c *gin.Context) {
 	}
 
 	deviceID := c.Param("device_id")
-	namespace := c.DefaultQuery("namespace", "monitoring")
+	namespace := c.DefaultQuery("namespace", kubernetes.GetNamespace())
 
 	result, err := kubernetes.DeleteDeviceResources(namespace, deviceID)
 	if err != nil {
@@ -201,7 +283,7 @@ func DeleteDeviceResources(c *gin.Context) {
 
 // GetKubernetesHealth handles GET /kubernetes/health
 func GetKubernetesHealth(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "monitoring")
+	namespace := c.DefaultQuery("namespace", kubernetes.GetNamespace())
 
 	health, err := kubernetes.CheckHealth(namespace)
 	if err != nil {
@@ -222,9 +304,9 @@ func CleanupKubernetes(c *gin.Context) {
 		return
 	}
 
-	namespace := c.DefaultQuery("namespace", "monitoring")
+	namespace := c.DefaultQuery("namespace", kubernetes.GetNamespace())
 
-	services, endpoints, err := kubernetes.CleanupAllResources(namespace)
+	services, endpoints, slices, err := kubernetes.CleanupAllResources(namespace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Cleanup failed",
@@ -234,10 +316,11 @@ func CleanupKubernetes(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":            "cleaned",
-		"deleted_services":  services,
-		"deleted_endpoints": endpoints,
-		"namespace":         namespace,
+		"status":                  "cleaned",
+		"deleted_services":        services,
+		"deleted_endpoints":       endpoints,
+		"deleted_endpoint_slices": slices,
+		"namespace":               namespace,
 	})
 }
 
@@ -262,12 +345,7 @@ func generateManifests(namespace string, devices []models.DeviceConfig) string {
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      serviceName,
 				Namespace: namespace,
-				Labels: map[string]string{
-					"app":         "edge-exporter",
-					"device_id":   device.DeviceID,
-					"device_type": device.DeviceType,
-					"managed_by":  "edge-metrics-server",
-				},
+				Labels:    kubernetes.ServiceLabels(device.DeviceID, device.DeviceType, device.Labels),
 			},
 			Spec: corev1.ServiceSpec{
 				ClusterIP: "None",
@@ -302,24 +380,62 @@ func generateManifests(namespace string, devices []models.DeviceConfig) string {
 			yaml += fmt.Sprintf("    protocol: %s\n", port.Protocol)
 		}
 
+		mode := kubernetes.GetEndpointsMode()
+
 		// Generate Endpoints manifest
-		yaml += "---\n"
-		yaml += "apiVersion: v1\n"
-		yaml += "kind: Endpoints\n"
-		yaml += "metadata:\n"
-		yaml += fmt.Sprintf("  name: %s\n", serviceName)
-		yaml += fmt.Sprintf("  namespace: %s\n", namespace)
-		yaml += "  labels:\n"
-		yaml += fmt.Sprintf("    app: edge-exporter\n")
-		yaml += fmt.Sprintf("    device_id: %s\n", device.DeviceID)
-		yaml += fmt.Sprintf("    managed_by: edge-metrics-server\n")
-		yaml += "subsets:\n"
-		yaml += "- addresses:\n"
-		yaml += fmt.Sprintf("  - ip: %s\n", device.IPAddress)
-		yaml += "  ports:\n"
-		yaml += fmt.Sprintf("  - name: metrics\n")
-		yaml += fmt.Sprintf("    port: %d\n", device.Port)
-		yaml += fmt.Sprintf("    protocol: TCP\n")
+		if mode != kubernetes.EndpointsModeSlice {
+			yaml += "---\n"
+			yaml += "apiVersion: v1\n"
+			yaml += "kind: Endpoints\n"
+			yaml += "metadata:\n"
+			yaml += fmt.Sprintf("  name: %s\n", serviceName)
+			yaml += fmt.Sprintf("  namespace: %s\n", namespace)
+			yaml += "  labels:\n"
+			yaml += fmt.Sprintf("    app: edge-exporter\n")
+			yaml += fmt.Sprintf("    device_id: %s\n", device.DeviceID)
+			yaml += fmt.Sprintf("    managed_by: edge-metrics-server\n")
+			if mode == kubernetes.EndpointsModeBoth {
+				yaml += "    endpointslice.kubernetes.io/skip-mirror: \"true\"\n"
+			}
+			yaml += "subsets:\n"
+			yaml += "- addresses:\n"
+			yaml += fmt.Sprintf("  - ip: %s\n", device.IPAddress)
+			yaml += "  ports:\n"
+			yaml += fmt.Sprintf("  - name: metrics\n")
+			yaml += fmt.Sprintf("    port: %d\n", device.Port)
+			yaml += fmt.Sprintf("    protocol: TCP\n")
+		}
+
+		// Generate EndpointSlice manifest
+		if mode != kubernetes.EndpointsModeLegacy {
+			addressType := "IPv4"
+			if ip := net.ParseIP(device.IPAddress); ip != nil && ip.To4() == nil {
+				addressType = "IPv6"
+			}
+
+			yaml += "---\n"
+			yaml += "apiVersion: discovery.k8s.io/v1\n"
+			yaml += "kind: EndpointSlice\n"
+			yaml += "metadata:\n"
+			yaml += fmt.Sprintf("  name: %s\n", serviceName)
+			yaml += fmt.Sprintf("  namespace: %s\n", namespace)
+			yaml += "  labels:\n"
+			yaml += fmt.Sprintf("    app: edge-exporter\n")
+			yaml += fmt.Sprintf("    device_id: %s\n", device.DeviceID)
+			yaml += fmt.Sprintf("    managed_by: edge-metrics-server\n")
+			yaml += fmt.Sprintf("    kubernetes.io/service-name: %s\n", serviceName)
+			yaml += fmt.Sprintf("    endpointslice.kubernetes.io/managed-by: edge-metrics-server\n")
+			yaml += fmt.Sprintf("addressType: %s\n", addressType)
+			yaml += "endpoints:\n"
+			yaml += "- addresses:\n"
+			yaml += fmt.Sprintf("  - %s\n", device.IPAddress)
+			yaml += "  conditions:\n"
+			yaml += "    ready: true\n"
+			yaml += "ports:\n"
+			yaml += fmt.Sprintf("- name: metrics\n")
+			yaml += fmt.Sprintf("  port: %d\n", device.Port)
+			yaml += fmt.Sprintf("  protocol: TCP\n")
+		}
 		yaml += "\n"
 	}
 
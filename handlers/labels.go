@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"edge-metrics-server/discovery"
+	"edge-metrics-server/kubernetes"
+	"edge-metrics-server/models"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// parseLabels converts the "labels" field of a request body into a label map
+// null clears all labels
+func parseLabels(value interface{}) (map[string]string, error) {
+	result := make(map[string]string)
+	if value == nil {
+		return result, nil
+	}
+
+	raw, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("labels must be an object of string values")
+	}
+
+	for key, v := range raw {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("label %q: value must be a string", key)
+		}
+		result[key] = s
+	}
+
+	return result, validateLabels(result)
+}
+
+// patchLabels applies a JSON merge patch to existing labels
+// Keys set to null are removed, a null patch clears all labels
+func patchLabels(existing map[string]string, value interface{}) (map[string]string, error) {
+	result := make(map[string]string)
+	if value == nil {
+		return result, nil
+	}
+
+	raw, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("labels must be an object of string values")
+	}
+
+	for key, v := range existing {
+		result[key] = v
+	}
+	for key, v := range raw {
+		if v == nil {
+			delete(result, key)
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("label %q: value must be a string", key)
+		}
+		result[key] = s
+	}
+
+	return result, validateLabels(result)
+}
+
+// validateLabels checks label keys and values with the Kubernetes label syntax
+// (labels are copied to the device Services). Keys must also stay distinct as
+// Prometheus label names, where unsupported characters become underscores.
+func validateLabels(labelMap map[string]string) error {
+	keys := make([]string, 0, len(labelMap))
+	for key := range labelMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	promNames := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if kubernetes.IsReservedLabel(key) {
+			return fmt.Errorf("label key %q is reserved", key)
+		}
+		name := discovery.PromLabelName(key)
+		if kubernetes.IsReservedLabel(name) {
+			return fmt.Errorf("label key %q is reserved as Prometheus label %q", key, name)
+		}
+		if other, exists := promNames[name]; exists {
+			return fmt.Errorf("label keys %q and %q are both Prometheus label %q", other, key, name)
+		}
+		promNames[name] = key
+		if errs := validation.IsValidLabelValue(labelMap[key]); len(errs) > 0 {
+			return fmt.Errorf("label %q value %q: %s", key, labelMap[key], strings.Join(errs, "; "))
+		}
+	}
+
+	return nil
+}
+
+// respondInvalidLabels writes the 400 response for invalid labels
+func respondInvalidLabels(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   "invalid_labels",
+		Message: err.Error(),
+	})
+}
+
+// parseSelectorQuery parses the ?selector= label selector (e.g. site=lab2,rack!=r1)
+// Returns false after writing a 400 response if the selector is invalid
+func parseSelectorQuery(c *gin.Context) (labels.Selector, bool) {
+	value := c.Query("selector")
+	if value == "" {
+		return labels.Everything(), true
+	}
+
+	selector, err := labels.Parse(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_selector",
+			Message: err.Error(),
+		})
+		return nil, false
+	}
+	return selector, true
+}
+
+// filterBySelector returns the devices whose labels match the selector
+func filterBySelector(devices []models.DeviceConfig, selector labels.Selector) []models.DeviceConfig {
+	if selector.Empty() {
+		return devices
+	}
+
+	filtered := make([]models.DeviceConfig, 0)
+	for _, device := range devices {
+		if selector.Matches(labels.Set(device.Labels)) {
+			filtered = append(filtered, device)
+		}
+	}
+	return filtered
+}
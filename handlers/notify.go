@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"edge-metrics-server/discovery"
+	"edge-metrics-server/kubernetes"
+	"edge-metrics-server/watch"
+)
+
+// notifyConfigChanged is called after a device's configuration, address or
+// approval state changed, so dependent state can be brought up to date
+func notifyConfigChanged(deviceID string) {
+	kubernetes.RequestReconcile(deviceID)
+	kubernetes.RequestMonitorResync()
+	discovery.Notify()
+	watch.Notify(deviceID)
+}
@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"edge-metrics-server/catalog"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+	"edge-metrics-server/secrets"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProfileRequest represents the request body for PUT /profiles/:name
+type ProfileRequest struct {
+	Description string                 `json:"description"`
+	Config      map[string]interface{} `json:"config" binding:"required"`
+}
+
+// deviceOnlyFields cannot be set by a profile (they identify or address a single device)
+var deviceOnlyFields = []string{"device_type", "ip_address", "port", "reload_port", "labels", "profiles"}
+
+// ListProfiles handles GET /profiles
+func ListProfiles(c *gin.Context) {
+	log.Printf("List profiles request")
+
+	profiles, err := repository.GetAllProfiles()
+	if err != nil {
+		log.Printf("Error fetching profiles: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch profiles",
+		})
+		return
+	}
+
+	if profiles == nil {
+		profiles = []models.Profile{}
+	}
+	for i := range profiles {
+		profiles[i].Config = secrets.Redact(profiles[i].Config)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"profiles": profiles,
+		"total":    len(profiles),
+	})
+}
+
+// GetProfile handles GET /profiles/:name
+// The response includes the devices using the profile
+func GetProfile(c *gin.Context) {
+	name := c.Param("name")
+	log.Printf("Get profile request: %s", name)
+
+	profile, err := repository.GetProfile(name)
+	if err != nil {
+		log.Printf("Error fetching profile %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch profile",
+		})
+		return
+	}
+
+	if profile == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Profile not found",
+			Message: fmt.Sprintf("No profile named %s", name),
+		})
+		return
+	}
+
+	deviceIDs, err := repository.GetProfileDeviceIDs(name)
+	if err != nil {
+		log.Printf("Error fetching devices of profile %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch profile devices",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":        profile.Name,
+		"description": profile.Description,
+		"config":      secrets.Redact(profile.Config),
+		"devices":     deviceIDs,
+		"created_at":  profile.CreatedAt,
+		"updated_at":  profile.UpdatedAt,
+	})
+}
+
+// PutProfile handles PUT /profiles/:name
+// Creates or replaces a profile and triggers a reload on every device using it
+func PutProfile(c *gin.Context) {
+	name := c.Param("name")
+	log.Printf("Put profile request: %s", name)
+
+	var req ProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := validateProfileConfig(req.Config); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_profile",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	existing, err := repository.GetProfile(name)
+	if err != nil {
+		log.Printf("Error fetching profile %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch profile",
+		})
+		return
+	}
+
+	// Redacted secret values sent back unchanged keep their stored values
+	if existing != nil {
+		req.Config = secrets.Restore(req.Config, existing.Config)
+	}
+
+	profile := models.Profile{
+		Name:        name,
+		Description: req.Description,
+		Config:      req.Config,
+	}
+
+	// Devices using the profile fetch their new effective config on reload
+	devices, err := profileDevices(name)
+	if err != nil {
+		log.Printf("Error fetching devices of profile %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch profile devices",
+		})
+		return
+	}
+
+	if errResp := checkProfile(&profile, devices); errResp != nil {
+		c.JSON(errorResponseStatus(errResp), errResp)
+		return
+	}
+
+	if err := repository.SaveProfile(&profile); err != nil {
+		log.Printf("Error saving profile %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to save profile",
+		})
+		return
+	}
+
+	status := "updated"
+	if existing == nil {
+		status = "created"
+	}
+
+	// Their effective config changed, so their ETags must change too
+	deviceIDs := make([]string, len(devices))
+	for i, device := range devices {
+		deviceIDs[i] = device.DeviceID
+	}
+	if err := repository.IncrementVersions(deviceIDs); err != nil {
+		log.Printf("Error updating versions of profile %s devices: %v", name, err)
+	}
+	for _, deviceID := range deviceIDs {
+		notifyConfigChanged(deviceID)
+	}
+
+	results, success, failed := reloadDevices(c.Request.Context(), devices, "profile")
+
+	log.Printf("Profile %s %s: %d devices reloaded, %d failed", name, status, success, failed)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  status,
+		"name":    name,
+		"results": results,
+		"total":   len(devices),
+		"success": success,
+		"failed":  failed,
+	})
+}
+
+// DeleteProfile handles DELETE /profiles/:name
+// Profiles still assigned to devices cannot be deleted
+func DeleteProfile(c *gin.Context) {
+	name := c.Param("name")
+	log.Printf("Delete profile request: %s", name)
+
+	deviceIDs, err := repository.GetProfileDeviceIDs(name)
+	if err != nil {
+		log.Printf("Error fetching devices of profile %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch profile devices",
+		})
+		return
+	}
+
+	if len(deviceIDs) > 0 {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Profile in use",
+			Message: fmt.Sprintf("Profile %s is used by: %s", name, strings.Join(deviceIDs, ", ")),
+		})
+		return
+	}
+
+	err = repository.DeleteProfile(name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "Profile not found",
+				Message: fmt.Sprintf("No profile named %s", name),
+			})
+			return
+		}
+		log.Printf("Error deleting profile %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to delete profile",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "deleted",
+		"name":   name,
+	})
+}
+
+// validateProfileConfig checks that a profile only holds enabled_metrics and extra config blocks
+func validateProfileConfig(config map[string]interface{}) error {
+	for _, field := range deviceOnlyFields {
+		if _, exists := config[field]; exists {
+			return fmt.Errorf("%s cannot be set in a profile", field)
+		}
+	}
+
+	if val, exists := config["enabled_metrics"]; exists {
+		metrics, ok := val.([]interface{})
+		if !ok {
+			return fmt.Errorf("enabled_metrics must be an array of strings")
+		}
+		for _, m := range metrics {
+			if _, ok := m.(string); !ok {
+				return fmt.Errorf("enabled_metrics must be an array of strings")
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkProfile checks the enabled_metrics of a profile against the metric catalog
+// and the effective config of every device using it like a device update: metrics
+// against the catalog of the device type, extra config blocks against its schemas.
+// Returns the error response if invalid, nil otherwise.
+func checkProfile(profile *models.Profile, devices []models.DeviceConfig) *models.ErrorResponse {
+	var metrics []string
+	if values, ok := profile.Config["enabled_metrics"].([]interface{}); ok {
+		for _, v := range values {
+			metrics = append(metrics, v.(string)) // Checked by validateProfileConfig
+		}
+	}
+	if unknown := catalog.UnknownMetricsAnyType(metrics); len(unknown) > 0 {
+		return &models.ErrorResponse{
+			Error:   "unknown_metrics",
+			Message: fmt.Sprintf("Unknown metrics: %s", strings.Join(unknown, ", ")),
+		}
+	}
+
+	var blocks []string
+	for key := range profile.Config {
+		if key != "enabled_metrics" {
+			blocks = append(blocks, key)
+		}
+	}
+
+	for i := range devices {
+		device := &devices[i]
+		effective, err := effectiveConfigWith(device, profile)
+		if err != nil {
+			log.Printf("Error merging profiles for %s: %v", device.DeviceID, err)
+			return &models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to merge config profiles",
+			}
+		}
+
+		var effectiveBlocks []string
+		for key := range effective.ExtraConfig {
+			effectiveBlocks = append(effectiveBlocks, key)
+		}
+		if unknown := catalog.UnknownMetrics(device.DeviceType, effectiveBlocks, effective.EnabledMetrics); len(unknown) > 0 {
+			return &models.ErrorResponse{
+				Error:    "unknown_metrics",
+				DeviceID: device.DeviceID,
+				Message: fmt.Sprintf("Unknown metrics for device type %s: %s",
+					device.DeviceType, strings.Join(unknown, ", ")),
+			}
+		}
+
+		schemas, err := repository.GetConfigSchemas(device.DeviceType)
+		if err != nil {
+			log.Printf("Error fetching config schemas for %s: %v", device.DeviceType, err)
+			return &models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to fetch config schemas",
+			}
+		}
+		if errResp := checkBlocks(effective, schemas, blocks); errResp != nil {
+			return errResp
+		}
+	}
+
+	return nil
+}
+
+// parseProfiles converts the "profiles" field of a request body into profile names
+// null clears all profiles; every profile must exist
+func parseProfiles(value interface{}) ([]string, *models.ErrorResponse) {
+	names := []string{}
+	if value == nil {
+		return names, nil
+	}
+
+	raw, ok := value.([]interface{})
+	if !ok {
+		return nil, &models.ErrorResponse{
+			Error:   "invalid_profiles",
+			Message: "profiles must be an array of profile names",
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, v := range raw {
+		name, ok := v.(string)
+		if !ok || name == "" {
+			return nil, &models.ErrorResponse{
+				Error:   "invalid_profiles",
+				Message: "profiles must be an array of profile names",
+			}
+		}
+		if seen[name] {
+			return nil, &models.ErrorResponse{
+				Error:   "invalid_profiles",
+				Message: fmt.Sprintf("Duplicate profile: %s", name),
+			}
+		}
+		seen[name] = true
+
+		profile, err := repository.GetProfile(name)
+		if err != nil {
+			log.Printf("Error fetching profile %s: %v", name, err)
+			return nil, &models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to fetch profile",
+			}
+		}
+		if profile == nil {
+			return nil, &models.ErrorResponse{
+				Error:   "unknown_profile",
+				Message: fmt.Sprintf("Profile not found: %s", name),
+			}
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// errorResponseStatus returns the HTTP status of a validation error response
+// (parseProfiles, applyConfigPatch): 500 for internal errors, 400 otherwise
+func errorResponseStatus(errResp *models.ErrorResponse) int {
+	if errResp.Error == "Internal server error" {
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// profileDevices returns the devices using a profile
+func profileDevices(name string) ([]models.DeviceConfig, error) {
+	deviceIDs, err := repository.GetProfileDeviceIDs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]models.DeviceConfig, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		device, err := repository.GetByDeviceID(deviceID)
+		if err != nil {
+			return nil, err
+		}
+		if device != nil {
+			devices = append(devices, *device)
+		}
+	}
+	return devices, nil
+}
+
+// effectiveConfig merges the profiles of a device into its config
+// Device values win over profiles and later profiles win over earlier ones;
+// extra config blocks are merged key by key
+func effectiveConfig(config *models.DeviceConfig) (*models.DeviceConfig, error) {
+	return effectiveConfigWith(config, nil)
+}
+
+// effectiveConfigWith is like effectiveConfig, with the stored profile of the same
+// name replaced by override (a profile that is validated before it is saved)
+func effectiveConfigWith(config *models.DeviceConfig, override *models.Profile) (*models.DeviceConfig, error) {
+	if len(config.Profiles) == 0 {
+		return config, nil
+	}
+
+	var enabledMetrics []string
+	extraConfig := make(map[string]interface{})
+
+	for _, name := range config.Profiles {
+		profile := override
+		if override == nil || override.Name != name {
+			var err error
+			if profile, err = repository.GetProfile(name); err != nil {
+				return nil, err
+			}
+		}
+		if profile == nil {
+			continue // Deleted while assigned
+		}
+
+		for key, value := range profile.Config {
+			if key == "enabled_metrics" {
+				enabledMetrics = nil
+				if metrics, ok := value.([]interface{}); ok {
+					for _, m := range metrics {
+						if s, ok := m.(string); ok {
+							enabledMetrics = append(enabledMetrics, s)
+						}
+					}
+				}
+				continue
+			}
+			extraConfig[key] = mergeJSON(extraConfig[key], value)
+		}
+	}
+
+	effective := cloneConfig(config)
+	if len(config.EnabledMetrics) == 0 {
+		effective.EnabledMetrics = enabledMetrics
+	}
+	for key, value := range config.ExtraConfig {
+		extraConfig[key] = mergeJSON(extraConfig[key], value)
+	}
+	effective.ExtraConfig = extraConfig
+
+	return &effective, nil
+}
+
+// mergeJSON merges override into base: objects are merged recursively,
+// any other override value replaces base
+func mergeJSON(base, override interface{}) interface{} {
+	baseMap, baseIsMap := base.(map[string]interface{})
+	overrideMap, overrideIsMap := override.(map[string]interface{})
+	if !baseIsMap || !overrideIsMap {
+		return override
+	}
+
+	merged := make(map[string]interface{}, len(baseMap)+len(overrideMap))
+	for key, value := range baseMap {
+		merged[key] = value
+	}
+	for key, value := range overrideMap {
+		merged[key] = mergeJSON(merged[key], value)
+	}
+	return merged
+}
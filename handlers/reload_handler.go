@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"edge-metrics-server/exporter"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reloadStatuses are the valid ?status filters of GET /reloads
+var reloadStatuses = map[string]bool{
+	models.ReloadPending:   true,
+	models.ReloadDelivered: true,
+	models.ReloadFailed:    true,
+	models.ReloadCancelled: true,
+}
+
+// GetDeviceReloads handles GET /devices/:device_id/reloads
+// Returns the most recent reload jobs of a device (?limit, default 20), newest first
+func GetDeviceReloads(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	log.Printf("List reloads request for device: %s", deviceID)
+
+	limit, ok := parseLimit(c, 20)
+	if !ok {
+		return
+	}
+
+	jobs, err := repository.GetReloadJobs(deviceID, limit)
+	if err != nil {
+		log.Printf("Error fetching reload jobs for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch reload jobs",
+		})
+		return
+	}
+
+	if jobs == nil {
+		jobs = []models.ReloadJob{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"reloads":   jobs,
+		"total":     len(jobs),
+	})
+}
+
+// ListReloads handles GET /reloads
+// Returns reload jobs of all devices by status (?status=pending,failed by default)
+func ListReloads(c *gin.Context) {
+	log.Printf("List reloads request")
+
+	statuses := splitQueryList(c.Query("status"))
+	if len(statuses) == 0 {
+		statuses = []string{models.ReloadPending, models.ReloadFailed}
+	}
+	for _, status := range statuses {
+		if !reloadStatuses[status] {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_status",
+				Message: fmt.Sprintf("Unknown reload status %q (expected pending, delivered, failed or cancelled)", status),
+			})
+			return
+		}
+	}
+
+	limit, ok := parseLimit(c, 100)
+	if !ok {
+		return
+	}
+
+	jobs, err := repository.GetReloadJobsByStatus(statuses, limit)
+	if err != nil {
+		log.Printf("Error fetching reload jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch reload jobs",
+		})
+		return
+	}
+
+	if jobs == nil {
+		jobs = []models.ReloadJob{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reloads": jobs,
+		"total":   len(jobs),
+	})
+}
+
+// queueReload queues a reload of a device in the reload outbox and makes the first
+// delivery attempt right away; failed deliveries are retried in the background.
+// Returns whether the device acknowledged the reload and the reload job status
+// afterwards (empty if the device has no IP address and nothing was queued)
+func queueReload(ctx context.Context, device models.DeviceConfig, reason string) (bool, string) {
+	if device.IPAddress == "" {
+		return false, ""
+	}
+
+	jobID, err := exporter.Enqueue(device.DeviceID, reason)
+	if err != nil {
+		log.Printf("Error queueing reload of %s: %v", device.DeviceID, err)
+		return false, ""
+	}
+
+	result, status := exporter.Deliver(ctx, jobID)
+	return result.Success, status
+}
+
+// parseLimit parses the ?limit query parameter
+// Returns false after writing a 400 response if it is not a positive number
+func parseLimit(c *gin.Context, defaultLimit int) (int, bool) {
+	v := c.Query("limit")
+	if v == "" {
+		return defaultLimit, true
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_limit",
+			Message: "Query parameter 'limit' must be a positive number",
+		})
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+	"edge-metrics-server/secrets"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RollbackRequest represents the request body for a rollback
+type RollbackRequest struct {
+	Revision int `json:"revision" binding:"required"`
+}
+
+// recordRevision saves a config revision and logs failures
+// Revision history is best effort and never fails the request (returns 0 on failure)
+func recordRevision(config *models.DeviceConfig, source string) int {
+	revision, err := repository.CreateRevision(config, source)
+	if err != nil {
+		log.Printf("Failed to record config revision for %s: %v", config.DeviceID, err)
+		return 0
+	}
+	log.Printf("Recorded config revision %d for %s (%s)", revision, config.DeviceID, source)
+	return revision
+}
+
+// revisionToMap builds the API representation of a config revision
+func revisionToMap(revision *models.ConfigRevision) gin.H {
+	config := gin.H(secrets.Redact(configToMap(&revision.Config)))
+	config["ip_address"] = revision.Config.IPAddress
+
+	return gin.H{
+		"device_id":  revision.DeviceID,
+		"revision":   revision.Revision,
+		"source":     revision.Source,
+		"created_at": revision.CreatedAt,
+		"config":     config,
+	}
+}
+
+// ListRevisions handles GET /config/:device_id/revisions
+func ListRevisions(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	log.Printf("List revisions request for device: %s", deviceID)
+
+	revisions, err := repository.GetRevisions(deviceID)
+	if err != nil {
+		log.Printf("Error fetching revisions for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch config revisions",
+		})
+		return
+	}
+
+	results := make([]gin.H, 0)
+	for i := range revisions {
+		results = append(results, revisionToMap(&revisions[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"revisions": results,
+		"total":     len(results),
+	})
+}
+
+// GetRevision handles GET /config/:device_id/revisions/:revision
+func GetRevision(c *gin.Context) {
+	deviceID := c.Param("device_id")
+
+	revisionNumber, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_revision",
+			Message: fmt.Sprintf("Invalid revision number: %s", c.Param("revision")),
+		})
+		return
+	}
+
+	revision, ok := fetchRevision(c, deviceID, revisionNumber)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, revisionToMap(revision))
+}
+
+// DiffRevisions handles GET /config/:device_id/diff?from=1&to=2
+// "to" defaults to the latest revision
+func DiffRevisions(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	log.Printf("Diff revisions request for device: %s", deviceID)
+
+	fromNumber, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_revision",
+			Message: "Query parameter 'from' must be a revision number",
+		})
+		return
+	}
+
+	from, ok := fetchRevision(c, deviceID, fromNumber)
+	if !ok {
+		return
+	}
+
+	var to *models.ConfigRevision
+	if toParam := c.Query("to"); toParam != "" {
+		toNumber, err := strconv.Atoi(toParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_revision",
+				Message: "Query parameter 'to' must be a revision number",
+			})
+			return
+		}
+		if to, ok = fetchRevision(c, deviceID, toNumber); !ok {
+			return
+		}
+	} else {
+		to, err = repository.GetLatestRevision(deviceID)
+		if err != nil || to == nil {
+			log.Printf("Error fetching latest revision for %s: %v", deviceID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to fetch latest revision",
+			})
+			return
+		}
+	}
+
+	changes, err := diffConfigs(&from.Config, &to.Config)
+	if err != nil {
+		log.Printf("Error diffing revisions for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to diff revisions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"from":      from.Revision,
+		"to":        to.Revision,
+		"changes":   changes,
+		"total":     len(changes),
+	})
+}
+
+// RollbackConfig handles POST /config/:device_id/rollback
+// Restores the config of a previous revision (ip_address is kept as is)
+// and triggers a reload the same way PUT does
+func RollbackConfig(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	log.Printf("Rollback request for device: %s", deviceID)
+
+	var req RollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	existing, err := repository.GetByDeviceID(deviceID)
+	if err != nil {
+		log.Printf("Error fetching device %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device",
+		})
+		return
+	}
+
+	if existing == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:    "Device not found",
+			DeviceID: deviceID,
+		})
+		return
+	}
+
+	revision, ok := fetchRevision(c, deviceID, req.Revision)
+	if !ok {
+		return
+	}
+
+	config := revision.Config
+	config.DeviceID = deviceID
+	config.IPAddress = existing.IPAddress
+
+	// The revision may predate the current catalog, schemas and label rules
+	if errResp := checkRevisionConfig(&config, existing.Labels); errResp != nil {
+		c.JSON(errorResponseStatus(errResp), errResp)
+		return
+	}
+
+	err = repository.Update(deviceID, &config)
+	if err != nil {
+		log.Printf("Error rolling back config for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to roll back device configuration",
+		})
+		return
+	}
+
+	newRevision := recordRevision(&config, "rollback")
+	notifyConfigChanged(config.DeviceID)
+
+	// Queue a reload of the exporter if IP is available
+	reloadTriggered, reloadStatus := queueReload(c.Request.Context(), config, "rollback")
+
+	response := gin.H{
+		"status":           "rolled_back",
+		"device_id":        deviceID,
+		"revision":         req.Revision,
+		"new_revision":     newRevision,
+		"reload_triggered": reloadTriggered,
+	}
+	if reloadStatus != "" {
+		response["reload_status"] = reloadStatus
+	}
+
+	log.Printf("Rolled back device %s to revision %d", deviceID, req.Revision)
+	c.JSON(http.StatusOK, response)
+}
+
+// checkRevisionConfig validates a config restored from a revision the way PUT
+// validates a new one. Revisions do not record labels, so the labels the device
+// keeps are checked. Returns the error response if the config is invalid
+func checkRevisionConfig(config *models.DeviceConfig, deviceLabels map[string]string) *models.ErrorResponse {
+	if errResp := checkPorts(config); errResp != nil {
+		return errResp
+	}
+	if errResp := checkEnabledMetrics(config); errResp != nil {
+		return errResp
+	}
+	if err := validateLabels(deviceLabels); err != nil {
+		return &models.ErrorResponse{
+			Error:    "invalid_labels",
+			DeviceID: config.DeviceID,
+			Message:  err.Error(),
+		}
+	}
+	return checkExtraConfig(config, nil)
+}
+
+// fetchRevision loads a revision and writes an error response if it cannot be found
+func fetchRevision(c *gin.Context, deviceID string, revisionNumber int) (*models.ConfigRevision, bool) {
+	revision, err := repository.GetRevision(deviceID, revisionNumber)
+	if err != nil {
+		log.Printf("Error fetching revision %d for %s: %v", revisionNumber, deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch config revision",
+		})
+		return nil, false
+	}
+
+	if revision == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:    "Revision not found",
+			DeviceID: deviceID,
+			Message:  fmt.Sprintf("No revision %d for this device", revisionNumber),
+		})
+		return nil, false
+	}
+
+	return revision, true
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+	"edge-metrics-server/schema"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSchemas handles GET /schemas
+func ListSchemas(c *gin.Context) {
+	log.Printf("List config schemas request")
+	respondSchemas(c, "")
+}
+
+// GetDeviceTypeSchemas handles GET /schemas/:device_type
+func GetDeviceTypeSchemas(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	log.Printf("Config schemas request for device type: %s", deviceType)
+	respondSchemas(c, deviceType)
+}
+
+// respondSchemas writes the schemas of a device type (all device types if empty)
+func respondSchemas(c *gin.Context, deviceType string) {
+	schemas, err := repository.GetConfigSchemas(deviceType)
+	if err != nil {
+		log.Printf("Error fetching config schemas: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch config schemas",
+		})
+		return
+	}
+
+	if schemas == nil {
+		schemas = []models.ConfigSchema{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schemas": schemas,
+		"total":   len(schemas),
+	})
+}
+
+// GetSchema handles GET /schemas/:device_type/:block
+func GetSchema(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	block := c.Param("block")
+	log.Printf("Config schema request: %s/%s", deviceType, block)
+
+	configSchema, err := repository.GetConfigSchema(deviceType, block)
+	if err != nil {
+		log.Printf("Error fetching config schema %s/%s: %v", deviceType, block, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch config schema",
+		})
+		return
+	}
+
+	if configSchema == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Schema not found",
+			Message: fmt.Sprintf("No schema for block %s of device type %s", block, deviceType),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, configSchema)
+}
+
+// PutSchema handles PUT /schemas/:device_type/:block
+// The request body is the JSON Schema itself. Existing configs are not revalidated;
+// they are checked the next time the block is written.
+func PutSchema(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	block := c.Param("block")
+	log.Printf("Put config schema request: %s/%s", deviceType, block)
+
+	var raw map[string]interface{}
+	if err := c.ShouldBindJSON(&raw); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if block == "enabled_metrics" || isDeviceOnlyField(block) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_schema",
+			Message: fmt.Sprintf("%s is a standard field, not an extra config block", block),
+		})
+		return
+	}
+
+	if _, err := schema.Compile(raw); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_schema",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	configSchema := models.ConfigSchema{
+		DeviceType: deviceType,
+		Block:      block,
+		Schema:     raw,
+	}
+	if err := repository.SaveConfigSchema(&configSchema); err != nil {
+		log.Printf("Error saving config schema %s/%s: %v", deviceType, block, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to save config schema",
+		})
+		return
+	}
+
+	saved, err := repository.GetConfigSchema(deviceType, block)
+	if err != nil || saved == nil {
+		log.Printf("Error fetching config schema %s/%s: %v", deviceType, block, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch config schema",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// DeleteSchema handles DELETE /schemas/:device_type/:block
+func DeleteSchema(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	block := c.Param("block")
+	log.Printf("Delete config schema request: %s/%s", deviceType, block)
+
+	err := repository.DeleteConfigSchema(deviceType, block)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "Schema not found",
+				Message: fmt.Sprintf("No schema for block %s of device type %s", block, deviceType),
+			})
+			return
+		}
+		log.Printf("Error deleting config schema %s/%s: %v", deviceType, block, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to delete config schema",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "deleted",
+		"device_type": deviceType,
+		"block":       block,
+	})
+}
+
+// validateExtraConfig checks the extra config blocks of a device against the
+// schemas of its device type. Writes an error response and returns false if invalid.
+func validateExtraConfig(c *gin.Context, config *models.DeviceConfig) bool {
+	if errResp := checkExtraConfig(config, nil); errResp != nil {
+		c.JSON(errorResponseStatus(errResp), errResp)
+		return false
+	}
+	return true
+}
+
+// checkExtraConfig checks extra config blocks against the schemas of the device type.
+// Only the given blocks are checked (all blocks if nil). Blocks are checked as merged
+// with the device profiles, so a device may set only part of a block a profile provides.
+// Returns the error response with field-level details if any block is invalid, nil otherwise.
+func checkExtraConfig(config *models.DeviceConfig, blocks []string) *models.ErrorResponse {
+	schemas, err := repository.GetConfigSchemas(config.DeviceType)
+	if err != nil {
+		log.Printf("Error fetching config schemas for %s: %v", config.DeviceType, err)
+		return &models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch config schemas",
+		}
+	}
+	if len(schemas) == 0 {
+		return nil
+	}
+
+	// Profiles are kept on update when not given
+	if config.Profiles == nil && config.DeviceID != "" {
+		profiles, err := repository.GetDeviceProfiles(config.DeviceID)
+		if err != nil {
+			log.Printf("Error fetching profiles for %s: %v", config.DeviceID, err)
+			return &models.ErrorResponse{
+				Error:   "Internal server error",
+				Message: "Failed to fetch device profiles",
+			}
+		}
+		withProfiles := *config
+		withProfiles.Profiles = profiles
+		config = &withProfiles
+	}
+
+	effective, err := effectiveConfig(config)
+	if err != nil {
+		log.Printf("Error merging profiles for %s: %v", config.DeviceID, err)
+		return &models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to merge config profiles",
+		}
+	}
+
+	return checkBlocks(effective, schemas, blocks)
+}
+
+// checkBlocks checks the extra config blocks of an effective config against the
+// schemas of its device type. Only the given blocks are checked (all blocks if nil).
+func checkBlocks(effective *models.DeviceConfig, schemas []models.ConfigSchema, blocks []string) *models.ErrorResponse {
+	if blocks == nil {
+		for block := range effective.ExtraConfig {
+			blocks = append(blocks, block)
+		}
+	}
+	sort.Strings(blocks)
+
+	bySchema := make(map[string]map[string]interface{}, len(schemas))
+	for _, s := range schemas {
+		bySchema[s.Block] = s.Schema
+	}
+
+	var details []models.FieldError
+	for _, block := range blocks {
+		raw, ok := bySchema[block]
+		if !ok {
+			continue
+		}
+		value, ok := effective.ExtraConfig[block]
+		if !ok {
+			continue // Removed block
+		}
+
+		compiled, err := schema.Compile(raw)
+		if err != nil {
+			log.Printf("Skipping invalid stored schema %s/%s: %v", effective.DeviceType, block, err)
+			continue
+		}
+		details = append(details, compiled.Validate(value, block)...)
+	}
+
+	if len(details) > 0 {
+		return &models.ErrorResponse{
+			Error:    "invalid_config",
+			DeviceID: effective.DeviceID,
+			Message:  fmt.Sprintf("Extra config does not match the schemas of device type %s", effective.DeviceType),
+			Details:  details,
+		}
+	}
+	return nil
+}
+
+// isDeviceOnlyField checks if a field is a standard device field
+func isDeviceOnlyField(field string) bool {
+	for _, f := range deviceOnlyFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-metrics-server/discovery"
+	"edge-metrics-server/kubernetes"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScrapeSettingsRequest represents the request body for PUT /scrape-settings/:device_type
+type ScrapeSettingsRequest struct {
+	Interval      string                 `json:"interval" binding:"required"`
+	ScrapeTimeout string                 `json:"scrape_timeout"`
+	MetricsPath   string                 `json:"metrics_path"`
+	Relabelings   []models.RelabelConfig `json:"relabelings"`
+}
+
+// promDurationPattern matches Prometheus durations (e.g. 15s, 1m30s, 500ms)
+var promDurationPattern = regexp.MustCompile(`^(([0-9]+)y)?(([0-9]+)w)?(([0-9]+)d)?(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?$`)
+
+// validRelabelActions are the relabel actions supported by Prometheus
+var validRelabelActions = map[string]bool{
+	"replace": true, "keep": true, "drop": true, "keepequal": true, "dropequal": true,
+	"hashmod": true, "labelmap": true, "labeldrop": true, "labelkeep": true,
+	"lowercase": true, "uppercase": true,
+}
+
+// ListScrapeSettings handles GET /scrape-settings
+func ListScrapeSettings(c *gin.Context) {
+	log.Printf("List scrape settings request")
+
+	settings, err := repository.GetAllScrapeSettings()
+	if err != nil {
+		log.Printf("Error fetching scrape settings: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch scrape settings",
+		})
+		return
+	}
+
+	if settings == nil {
+		settings = []models.ScrapeSettings{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scrape_settings": settings,
+		"total":           len(settings),
+		"defaults": gin.H{
+			"interval":     kubernetes.DefaultScrapeInterval,
+			"metrics_path": kubernetes.DefaultMetricsPath,
+		},
+	})
+}
+
+// GetScrapeSettings handles GET /scrape-settings/:device_type
+func GetScrapeSettings(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	log.Printf("Get scrape settings request for device type: %s", deviceType)
+
+	settings, err := repository.GetScrapeSettings(deviceType)
+	if err != nil {
+		log.Printf("Error fetching scrape settings for %s: %v", deviceType, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch scrape settings",
+		})
+		return
+	}
+
+	if settings == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Scrape settings not found",
+			Message: fmt.Sprintf("No scrape settings for device type: %s (defaults apply)", deviceType),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// PutScrapeSettings handles PUT /scrape-settings/:device_type
+func PutScrapeSettings(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	log.Printf("Put scrape settings request for device type: %s", deviceType)
+
+	var req ScrapeSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	settings := models.ScrapeSettings{
+		DeviceType:    deviceType,
+		Interval:      req.Interval,
+		ScrapeTimeout: req.ScrapeTimeout,
+		MetricsPath:   req.MetricsPath,
+		Relabelings:   req.Relabelings,
+	}
+	if settings.MetricsPath == "" {
+		settings.MetricsPath = kubernetes.DefaultMetricsPath
+	}
+	if settings.Relabelings == nil {
+		settings.Relabelings = []models.RelabelConfig{}
+	}
+
+	if err := validateScrapeSettings(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_scrape_settings",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := repository.SaveScrapeSettings(&settings); err != nil {
+		log.Printf("Error saving scrape settings for %s: %v", deviceType, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to save scrape settings",
+		})
+		return
+	}
+
+	// Scrape settings are exported as labels of the SD targets
+	discovery.Notify()
+
+	saved, err := repository.GetScrapeSettings(deviceType)
+	if err != nil || saved == nil {
+		log.Printf("Error fetching scrape settings for %s: %v", deviceType, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch scrape settings",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// DeleteScrapeSettings handles DELETE /scrape-settings/:device_type
+func DeleteScrapeSettings(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	log.Printf("Delete scrape settings request for device type: %s", deviceType)
+
+	err := repository.DeleteScrapeSettings(deviceType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "Scrape settings not found",
+				Message: fmt.Sprintf("No scrape settings for device type: %s", deviceType),
+			})
+			return
+		}
+		log.Printf("Error deleting scrape settings for %s: %v", deviceType, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to delete scrape settings",
+		})
+		return
+	}
+
+	discovery.Notify()
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "deleted",
+		"device_type": deviceType,
+	})
+}
+
+// validateScrapeSettings checks durations, the metrics path and relabel rules
+func validateScrapeSettings(settings *models.ScrapeSettings) error {
+	interval, err := parsePromDuration(settings.Interval)
+	if err != nil {
+		return fmt.Errorf("interval: %w", err)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("interval: must be greater than 0")
+	}
+
+	if settings.ScrapeTimeout != "" {
+		timeout, err := parsePromDuration(settings.ScrapeTimeout)
+		if err != nil {
+			return fmt.Errorf("scrape_timeout: %w", err)
+		}
+		if timeout <= 0 || timeout > interval {
+			return fmt.Errorf("scrape_timeout: must be greater than 0 and not exceed interval (%s)", settings.Interval)
+		}
+	}
+
+	if !strings.HasPrefix(settings.MetricsPath, "/") {
+		return fmt.Errorf("metrics_path: must start with /")
+	}
+
+	for i, r := range settings.Relabelings {
+		action := r.Action
+		if action == "" {
+			action = "replace" // Prometheus default
+		}
+		if !validRelabelActions[action] {
+			return fmt.Errorf("relabelings[%d].action: unknown action %q", i, r.Action)
+		}
+		if r.Regex != "" {
+			if _, err := regexp.Compile(r.Regex); err != nil {
+				return fmt.Errorf("relabelings[%d].regex: %v", i, err)
+			}
+		}
+		if (action == "replace" || action == "hashmod") && r.TargetLabel == "" {
+			return fmt.Errorf("relabelings[%d].target_label: required for action %q", i, action)
+		}
+	}
+
+	return nil
+}
+
+// parsePromDuration parses a Prometheus duration (units y, w, d, h, m, s, ms)
+func parsePromDuration(s string) (time.Duration, error) {
+	matches := promDurationPattern.FindStringSubmatch(s)
+	if s == "" || matches == nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	units := []time.Duration{
+		365 * 24 * time.Hour,
+		7 * 24 * time.Hour,
+		24 * time.Hour,
+		time.Hour,
+		time.Minute,
+		time.Second,
+		time.Millisecond,
+	}
+
+	var total time.Duration
+	for i, unit := range units {
+		value := matches[2*i+2]
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += time.Duration(n) * unit
+	}
+
+	return total, nil
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"edge-metrics-server/auth"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+	"edge-metrics-server/secrets"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reservedSecretBlocks are config fields that cannot hold secrets (not extra config)
+var reservedSecretBlocks = map[string]bool{
+	"device_type":     true,
+	"port":            true,
+	"reload_port":     true,
+	"enabled_metrics": true,
+	"ip_address":      true,
+	"labels":          true,
+	"profiles":        true,
+}
+
+// LoadSecretPaths loads the secret paths from the database
+// Called on startup and after the secret paths change.
+func LoadSecretPaths() error {
+	paths, err := repository.GetSecretPaths()
+	if err != nil {
+		return err
+	}
+
+	list := make([]string, 0, len(paths))
+	for _, path := range paths {
+		list = append(list, path.Path)
+	}
+	secrets.SetPaths(list)
+	return nil
+}
+
+// ListSecretPaths handles GET /secret-paths
+func ListSecretPaths(c *gin.Context) {
+	log.Printf("List secret paths request")
+
+	paths, err := repository.GetSecretPaths()
+	if err != nil {
+		log.Printf("Error fetching secret paths: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch secret paths",
+		})
+		return
+	}
+
+	if paths == nil {
+		paths = []models.SecretPath{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"paths":              paths,
+		"total":              len(paths),
+		"encryption_enabled": secrets.Enabled(),
+	})
+}
+
+// PutSecretPath handles PUT /secret-paths/:path
+// Marks an extra config path (e.g. shelly.password) as secret and encrypts the
+// values already stored at it
+func PutSecretPath(c *gin.Context) {
+	path := c.Param("path")
+	log.Printf("Put secret path request: %s", path)
+
+	if err := validateSecretPath(path); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_secret_path",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if !secrets.Enabled() {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "encryption_disabled",
+			Message: "Set CONFIG_ENCRYPTION_KEY or CONFIG_ENCRYPTION_KEY_FILE to store secrets",
+		})
+		return
+	}
+
+	created, err := repository.AddSecretPath(path)
+	if err != nil {
+		log.Printf("Error saving secret path %s: %v", path, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to save secret path",
+		})
+		return
+	}
+
+	resealed, ok := resealSecrets(c)
+	if !ok {
+		return
+	}
+
+	status, code := "unchanged", http.StatusOK
+	if created {
+		status, code = "created", http.StatusCreated
+	}
+
+	log.Printf("Secret path %s %s, %d stored configs re-encrypted", path, status, resealed)
+	c.JSON(code, gin.H{
+		"status":   status,
+		"path":     path,
+		"resealed": resealed,
+	})
+}
+
+// DeleteSecretPath handles DELETE /secret-paths/:path
+// The values stored at the path are decrypted again
+func DeleteSecretPath(c *gin.Context) {
+	path := c.Param("path")
+	log.Printf("Delete secret path request: %s", path)
+
+	if err := repository.DeleteSecretPath(path); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "Secret path not found",
+				Message: fmt.Sprintf("%s is not a secret path", path),
+			})
+			return
+		}
+		log.Printf("Error deleting secret path %s: %v", path, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to delete secret path",
+		})
+		return
+	}
+
+	resealed, ok := resealSecrets(c)
+	if !ok {
+		return
+	}
+
+	log.Printf("Secret path %s deleted, %d stored configs decrypted", path, resealed)
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "deleted",
+		"path":     path,
+		"resealed": resealed,
+	})
+}
+
+// resealSecrets reloads the secret paths and rewrites the stored configs accordingly
+// Returns false after writing an error response if that failed
+func resealSecrets(c *gin.Context) (int, bool) {
+	if err := LoadSecretPaths(); err != nil {
+		log.Printf("Error loading secret paths: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to load secret paths",
+		})
+		return 0, false
+	}
+
+	resealed, err := repository.ResealSecrets()
+	if err != nil {
+		log.Printf("Error re-encrypting stored configs: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to re-encrypt stored configs",
+		})
+		return 0, false
+	}
+	return resealed, true
+}
+
+// validateSecretPath checks a dotted extra config path (block name first)
+func validateSecretPath(path string) error {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("Invalid secret path %q (expected dotted extra config path, e.g. shelly.password)", path)
+		}
+	}
+	if reservedSecretBlocks[segments[0]] {
+		return fmt.Errorf("%s is not an extra config block", segments[0])
+	}
+	return nil
+}
+
+// exporterConfigMap builds the GET /config/:device_id representation of a config
+// Secret values are only sent decrypted to the device itself (authenticated with
+// its device token) and redacted for everyone else.
+func exporterConfigMap(c *gin.Context, config *models.DeviceConfig) gin.H {
+	response := configToMap(config)
+	if principal := auth.FromContext(c); principal != nil && principal.Method == "device" {
+		return response
+	}
+	return gin.H(secrets.Redact(response))
+}
+
+// redactChanges redacts the values of config changes at secret paths
+func redactChanges(changes []models.ConfigChange) []models.ConfigChange {
+	for i := range changes {
+		changes[i].Old = secrets.RedactValue(changes[i].Path, changes[i].Old)
+		changes[i].New = secrets.RedactValue(changes[i].Path, changes[i].New)
+	}
+	return changes
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+
+	"edge-metrics-server/catalog"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+	"edge-metrics-server/secrets"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Server defaults used when a device type has no template (or the template leaves them unset)
+const (
+	defaultPort       = 9100
+	defaultReloadPort = 9101
+)
+
+// TemplateRequest represents the request body for PUT /templates/:device_type
+type TemplateRequest struct {
+	Port           int                    `json:"port"`
+	ReloadPort     int                    `json:"reload_port"`
+	EnabledMetrics []string               `json:"enabled_metrics"`
+	ExtraConfig    map[string]interface{} `json:"extra_config"`
+}
+
+// SeedTemplatesFromCatalog creates a template for every catalog device type that was
+// never seeded, enabling the metrics marked true in the catalog. Existing templates
+// are left untouched and deleted ones are not created again.
+// Returns the number of templates created.
+func SeedTemplatesFromCatalog() (int, error) {
+	created := 0
+	for _, deviceType := range catalog.DeviceTypes() {
+		entry, _ := catalog.Get(deviceType)
+
+		template := models.DeviceTemplate{
+			DeviceType:     deviceType,
+			Port:           defaultPort,
+			ReloadPort:     defaultReloadPort,
+			EnabledMetrics: entry.DefaultEnabled,
+			ExtraConfig:    map[string]interface{}{},
+		}
+		ok, err := repository.SeedTemplate(&template)
+		if err != nil {
+			return created, fmt.Errorf("failed to seed template for %s: %w", deviceType, err)
+		}
+		if ok {
+			created++
+		}
+	}
+	return created, nil
+}
+
+// ListTemplates handles GET /templates
+func ListTemplates(c *gin.Context) {
+	log.Printf("List templates request")
+
+	templates, err := repository.GetAllTemplates()
+	if err != nil {
+		log.Printf("Error fetching templates: %v", err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch templates",
+		})
+		return
+	}
+
+	if templates == nil {
+		templates = []models.DeviceTemplate{}
+	}
+	for i := range templates {
+		templates[i].ExtraConfig = secrets.Redact(templates[i].ExtraConfig)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"total":     len(templates),
+		"defaults": gin.H{
+			"port":        defaultPort,
+			"reload_port": defaultReloadPort,
+		},
+	})
+}
+
+// GetTemplate handles GET /templates/:device_type
+func GetTemplate(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	log.Printf("Get template request for device type: %s", deviceType)
+
+	template, err := repository.GetTemplate(deviceType)
+	if err != nil {
+		log.Printf("Error fetching template for %s: %v", deviceType, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch template",
+		})
+		return
+	}
+
+	if template == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Template not found",
+			Message: fmt.Sprintf("No template for device type: %s (server defaults apply)", deviceType),
+		})
+		return
+	}
+
+	template.ExtraConfig = secrets.Redact(template.ExtraConfig)
+	c.JSON(http.StatusOK, template)
+}
+
+// PutTemplate handles PUT /templates/:device_type
+// Existing devices are not changed; the template applies to devices created afterwards
+// and to fields they reset to null
+func PutTemplate(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	log.Printf("Put template request for device type: %s", deviceType)
+
+	var req TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	template := models.DeviceTemplate{
+		DeviceType:     deviceType,
+		Port:           req.Port,
+		ReloadPort:     req.ReloadPort,
+		EnabledMetrics: req.EnabledMetrics,
+		ExtraConfig:    req.ExtraConfig,
+	}
+	if template.EnabledMetrics == nil {
+		template.EnabledMetrics = []string{}
+	}
+	if template.ExtraConfig == nil {
+		template.ExtraConfig = map[string]interface{}{}
+	}
+
+	existing, err := repository.GetTemplate(deviceType)
+	if err != nil {
+		log.Printf("Error fetching template for %s: %v", deviceType, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch template",
+		})
+		return
+	}
+
+	// Redacted secret values sent back unchanged keep their stored values
+	if existing != nil {
+		template.ExtraConfig = secrets.Restore(template.ExtraConfig, existing.ExtraConfig)
+	}
+
+	if err := validateTemplate(&template); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_template",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := repository.SaveTemplate(&template); err != nil {
+		log.Printf("Error saving template for %s: %v", deviceType, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to save template",
+		})
+		return
+	}
+
+	saved, err := repository.GetTemplate(deviceType)
+	if err != nil || saved == nil {
+		log.Printf("Error fetching template for %s: %v", deviceType, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch template",
+		})
+		return
+	}
+
+	saved.ExtraConfig = secrets.Redact(saved.ExtraConfig)
+	c.JSON(http.StatusOK, saved)
+}
+
+// DeleteTemplate handles DELETE /templates/:device_type
+// Devices of the type keep the values copied from the template
+func DeleteTemplate(c *gin.Context) {
+	deviceType := c.Param("device_type")
+	log.Printf("Delete template request for device type: %s", deviceType)
+
+	err := repository.DeleteTemplate(deviceType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "Template not found",
+				Message: fmt.Sprintf("No template for device type: %s", deviceType),
+			})
+			return
+		}
+		log.Printf("Error deleting template for %s: %v", deviceType, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to delete template",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "deleted",
+		"device_type": deviceType,
+	})
+}
+
+// validateTemplate checks ports and enabled_metrics (against the metric catalog)
+func validateTemplate(template *models.DeviceTemplate) error {
+	if template.Port < 0 || template.Port > 65535 {
+		return fmt.Errorf("port: must be between 0 and 65535 (0 uses the server default)")
+	}
+	if template.ReloadPort < 0 || template.ReloadPort > 65535 {
+		return fmt.Errorf("reload_port: must be between 0 and 65535 (0 uses the server default)")
+	}
+
+	config := models.DeviceConfig{
+		DeviceType:     template.DeviceType,
+		EnabledMetrics: template.EnabledMetrics,
+		ExtraConfig:    template.ExtraConfig,
+	}
+	if errResp := checkEnabledMetrics(&config); errResp != nil {
+		return fmt.Errorf("%s", errResp.Message)
+	}
+
+	return nil
+}
+
+// templateFor returns the template of a device type, or nil if it has none
+// Lookup errors are logged and treated as no template
+func templateFor(deviceType string) *models.DeviceTemplate {
+	template, err := repository.GetTemplate(deviceType)
+	if err != nil {
+		log.Printf("Error fetching template for %s: %v", deviceType, err)
+		return nil
+	}
+	return template
+}
+
+// applyTemplate fills a new device config with the defaults of its device type.
+// Ports are defaulted when unset; enabled_metrics and extra config blocks are
+// copied when absent from provided (the request body), so later template changes
+// do not reach existing devices. Devices with profiles only get default ports,
+// so the profiles are not masked by device-level values.
+func applyTemplate(config *models.DeviceConfig, provided map[string]interface{}) {
+	template := templateFor(config.DeviceType)
+
+	if config.Port == 0 {
+		config.Port = defaultPort
+		if template != nil && template.Port != 0 {
+			config.Port = template.Port
+		}
+	}
+	if config.ReloadPort == 0 {
+		config.ReloadPort = defaultReloadPort
+		if template != nil && template.ReloadPort != 0 {
+			config.ReloadPort = template.ReloadPort
+		}
+	}
+
+	if template == nil || len(config.Profiles) > 0 {
+		return
+	}
+
+	if _, ok := provided["enabled_metrics"]; !ok && len(template.EnabledMetrics) > 0 {
+		config.EnabledMetrics = append([]string(nil), template.EnabledMetrics...)
+	}
+
+	if config.ExtraConfig == nil {
+		config.ExtraConfig = make(map[string]interface{})
+	}
+	for key, block := range template.ExtraConfig {
+		if value, ok := config.ExtraConfig[key]; ok {
+			config.ExtraConfig[key] = mergeJSON(block, value) // Request values win
+		} else {
+			config.ExtraConfig[key] = block
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+	"edge-metrics-server/watch"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Watch timing (long-poll timeout bounds and SSE keepalive interval)
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 5 * time.Minute
+	sseKeepalive        = 15 * time.Second
+)
+
+// WatchConfig handles GET /config/:device_id/watch
+// Lets exporters that cannot accept inbound reload requests pick up config changes.
+//
+// Long-poll (default): returns the effective config as soon as its version differs
+// from the one the client has (?version=3 or If-None-Match: "v3"); if it does not
+// change within ?timeout (default 30s, max 5m) 304 is returned.
+//
+// Server-Sent Events (?stream=true or Accept: text/event-stream): sends a "config"
+// event with the effective config on connect (unless Last-Event-ID is current) and
+// after every change, and a "deleted" event before closing if the device is deleted.
+func WatchConfig(c *gin.Context) {
+	deviceID := c.Param("device_id")
+
+	stream := c.Query("stream") == "true" || strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+
+	knownHeader := c.GetHeader("If-None-Match")
+	if stream {
+		knownHeader = c.GetHeader("Last-Event-ID")
+	}
+	if v := c.Query("version"); v != "" {
+		knownHeader = v
+	}
+	known, err := parseConfigVersion(knownHeader)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_version",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	timeout := defaultWatchTimeout
+	if t := c.Query("timeout"); t != "" {
+		timeout, err = time.ParseDuration(t)
+		if err != nil || timeout <= 0 || timeout > maxWatchTimeout {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_timeout",
+				Message: fmt.Sprintf("timeout must be a duration between 0s and %s", maxWatchTimeout),
+			})
+			return
+		}
+	}
+
+	// Start watching before reading the config so no change is missed
+	watcher := watch.Watch(deviceID)
+	defer watcher.Close()
+
+	config, ok := fetchWatchedConfig(c, deviceID)
+	if !ok {
+		return
+	}
+
+	if stream {
+		log.Printf("Config watch stream opened for %s", deviceID)
+		streamConfig(c, deviceID, config, watcher, known)
+		log.Printf("Config watch stream closed for %s", deviceID)
+		return
+	}
+
+	log.Printf("Config watch request for %s (version %d, timeout %s)", deviceID, known, timeout)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for config.Version == known {
+		select {
+		case <-watcher.Changed():
+		case <-timer.C:
+			c.Header("ETag", configETag(config.Version))
+			c.Status(http.StatusNotModified)
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+
+		watcher.Rearm()
+		if config, ok = fetchWatchedConfig(c, deviceID); !ok {
+			return
+		}
+	}
+
+	response, err := effectiveConfigMap(c, config)
+	if err != nil {
+		log.Printf("Error merging profiles for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device profiles",
+		})
+		return
+	}
+
+	c.Header("ETag", configETag(config.Version))
+	c.JSON(http.StatusOK, response)
+}
+
+// streamConfig sends the config of a device as Server-Sent Events until the
+// client disconnects or the device is deleted
+func streamConfig(c *gin.Context, deviceID string, config *models.DeviceConfig, watcher *watch.Watcher, known int) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		if config == nil {
+			data, _ := json.Marshal(gin.H{"device_id": deviceID})
+			writeEvent(c, "deleted", "", data)
+			return
+		}
+
+		if config.Version != known {
+			response, err := effectiveConfigMap(c, config)
+			if err != nil {
+				log.Printf("Error merging profiles for %s: %v", deviceID, err)
+				return
+			}
+			data, err := json.Marshal(response)
+			if err != nil {
+				log.Printf("Error encoding config for %s: %v", deviceID, err)
+				return
+			}
+			writeEvent(c, "config", fmt.Sprintf("v%d", config.Version), data)
+			known = config.Version
+		}
+
+	wait:
+		for {
+			select {
+			case <-watcher.Changed():
+				break wait
+			case <-keepalive.C:
+				fmt.Fprint(c.Writer, ": keepalive\n\n")
+				c.Writer.Flush()
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+
+		watcher.Rearm()
+		var err error
+		config, err = repository.GetByDeviceID(deviceID)
+		if err != nil {
+			log.Printf("Error fetching config for %s: %v", deviceID, err)
+			return
+		}
+	}
+}
+
+// writeEvent writes a single Server-Sent Event and flushes it to the client
+func writeEvent(c *gin.Context, event, id string, data []byte) {
+	if id != "" {
+		fmt.Fprintf(c.Writer, "id: %s\n", id)
+	}
+	fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data)
+	c.Writer.Flush()
+}
+
+// fetchWatchedConfig loads the config of a watched device
+// Returns false after writing an error response if it cannot be loaded or does not exist
+func fetchWatchedConfig(c *gin.Context, deviceID string) (*models.DeviceConfig, bool) {
+	config, err := repository.GetByDeviceID(deviceID)
+	if err != nil {
+		log.Printf("Error fetching config for %s: %v", deviceID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: "Failed to fetch device configuration",
+		})
+		return nil, false
+	}
+
+	if config == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:    "Device not found",
+			DeviceID: deviceID,
+			Message:  "No configuration available for this device",
+		})
+		return nil, false
+	}
+
+	return config, true
+}
+
+// effectiveConfigMap returns the effective config in the GET /config/:device_id format
+func effectiveConfigMap(c *gin.Context, config *models.DeviceConfig) (gin.H, error) {
+	effective, err := effectiveConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return exporterConfigMap(c, effective), nil
+}
+
+// parseConfigVersion parses a config version given as an ETag ("v3", W/"v3"), v3 or 3
+// Returns 0 if empty
+func parseConfigVersion(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	trimmed := strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.Atoi(strings.TrimPrefix(trimmed, "v"))
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid config version: %s", value)
+	}
+	return version, nil
+}
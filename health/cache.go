@@ -0,0 +1,50 @@
+package health
+
+import (
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+)
+
+// FromCache builds a DeviceStatus from a cached health record
+// A nil record means the device has not been checked yet
+func FromCache(device models.DeviceConfig, cached *models.DeviceHealth) models.DeviceStatus {
+	status := newStatus(device)
+
+	if cached == nil {
+		status.Status = "unknown"
+		if device.IPAddress == "" {
+			status.Error = "No IP address registered"
+		} else {
+			status.Error = "Not checked yet"
+		}
+		return status
+	}
+
+	status.Status = cached.Status
+	status.LastSeen = cached.LastSeen
+	status.LastChecked = cached.LastChecked
+	status.ConsecutiveFailures = cached.ConsecutiveFailures
+	status.LatencyMs = cached.LatencyMs
+	status.Error = cached.LastError
+
+	return status
+}
+
+// CachedStatuses returns the cached status of each device without probing them
+func CachedStatuses(devices []models.DeviceConfig) ([]models.DeviceStatus, error) {
+	healthByDevice, err := repository.GetAllHealth()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]models.DeviceStatus, 0, len(devices))
+	for _, device := range devices {
+		var cached *models.DeviceHealth
+		if record, ok := healthByDevice[device.DeviceID]; ok {
+			cached = &record
+		}
+		statuses = append(statuses, FromCache(device, cached))
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,141 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"edge-metrics-server/fanout"
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+)
+
+// Check probes a device's /health endpoint, stores the result in the
+// health cache and returns the resulting status
+// Status changes are reported to the OnStatusChange hooks
+func Check(device models.DeviceConfig) models.DeviceStatus {
+	return CheckContext(context.Background(), device)
+}
+
+// CheckContext is like Check but aborts the probe when ctx is done
+// An aborted probe says nothing about the device, so it is not recorded.
+func CheckContext(ctx context.Context, device models.DeviceConfig) models.DeviceStatus {
+	status := probe(ctx, device)
+	checkedAt := time.Now()
+
+	if status.Status == "unreachable" && ctx.Err() != nil {
+		return deadlineExceeded(device)
+	}
+
+	oldStatus := ""
+	if previous, err := repository.GetHealth(device.DeviceID); err == nil && previous != nil {
+		oldStatus = previous.Status
+	}
+
+	if err := repository.SaveHealthCheck(device.DeviceID, status.Status, status.Error, status.LatencyMs, checkedAt); err != nil {
+		log.Printf("Failed to save health check for %s: %v", device.DeviceID, err)
+		return status
+	}
+
+	if status.Status != oldStatus {
+		notifyStatusChange(device.DeviceID, oldStatus, status.Status)
+	}
+
+	// Return the cached view so last_seen / consecutive_failures are filled in
+	cached, err := repository.GetHealth(device.DeviceID)
+	if err != nil || cached == nil {
+		return status
+	}
+	return FromCache(device, cached)
+}
+
+// CheckAll checks devices in parallel (bounded by the fanout worker pool)
+// Devices that could not be checked before the deadline are reported as unknown
+func CheckAll(ctx context.Context, devices []models.DeviceConfig) []models.DeviceStatus {
+	return CheckAllWithin(ctx, devices, fanout.Deadline())
+}
+
+// CheckAllWithin is like CheckAll with its own overall deadline
+func CheckAllWithin(ctx context.Context, devices []models.DeviceConfig, timeout time.Duration) []models.DeviceStatus {
+	statuses := make([]models.DeviceStatus, len(devices))
+
+	started := fanout.RunWithin(ctx, timeout, len(devices), func(ctx context.Context, i int) {
+		statuses[i] = CheckContext(ctx, devices[i])
+	})
+
+	for i, ok := range started {
+		if !ok {
+			statuses[i] = deadlineExceeded(devices[i])
+		}
+	}
+
+	return statuses
+}
+
+// deadlineExceeded is the status of a device that could not be checked in time
+func deadlineExceeded(device models.DeviceConfig) models.DeviceStatus {
+	status := newStatus(device)
+	status.Status = "unknown"
+	status.Error = "health check deadline exceeded"
+	return status
+}
+
+// probe performs a single health check request against a device
+func probe(ctx context.Context, device models.DeviceConfig) models.DeviceStatus {
+	status := newStatus(device)
+
+	// Check if IP address is available
+	if device.IPAddress == "" || device.IPAddress == "unknown" {
+		status.Status = "unknown"
+		if device.IPAddress == "" {
+			status.Error = "No IP address registered"
+		}
+		return status
+	}
+
+	// Perform health check
+	healthURL := fmt.Sprintf("http://%s:%d/health", device.IPAddress, device.ReloadPort)
+	client := &http.Client{Timeout: 2 * time.Second}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		status.Status = "unreachable"
+		status.Error = err.Error()
+		return status
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	status.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		status.Status = "unreachable"
+		status.Error = err.Error()
+		return status
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		status.Status = "healthy"
+		status.LastSeen = time.Now().Format(time.RFC3339)
+	} else {
+		status.Status = "unhealthy"
+		status.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+
+	return status
+}
+
+// newStatus builds a DeviceStatus with the device's basic information
+func newStatus(device models.DeviceConfig) models.DeviceStatus {
+	return models.DeviceStatus{
+		DeviceID:       device.DeviceID,
+		DeviceType:     device.DeviceType,
+		IPAddress:      device.IPAddress,
+		Port:           device.Port,
+		ReloadPort:     device.ReloadPort,
+		ApprovalStatus: device.ApprovalStatus,
+		Labels:         device.Labels,
+	}
+}
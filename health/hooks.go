@@ -0,0 +1,32 @@
+package health
+
+import (
+	"sync"
+)
+
+// StatusChangeFunc is called when the health status of a device changes
+// oldStatus is empty for the first check of a device
+type StatusChangeFunc func(deviceID, oldStatus, newStatus string)
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []StatusChangeFunc
+)
+
+// OnStatusChange registers a function called whenever a health check changes
+// a device's cached status. Hooks run synchronously on the checking goroutine
+// and should return quickly.
+func OnStatusChange(fn StatusChangeFunc) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// notifyStatusChange runs the registered hooks
+func notifyStatusChange(deviceID, oldStatus, newStatus string) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, fn := range hooks {
+		fn(deviceID, oldStatus, newStatus)
+	}
+}
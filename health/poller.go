@@ -0,0 +1,52 @@
+package health
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"edge-metrics-server/repository"
+)
+
+// StartPoller starts a background goroutine that checks every device
+// on the given interval and keeps the health cache up to date
+// Each round has its own deadline, independent of the interactive fanout one.
+func StartPoller(interval, deadline time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			PollOnce(deadline)
+			<-ticker.C
+		}
+	}()
+}
+
+// PollOnce checks the health of all registered devices once
+// Devices not checked within the deadline keep their cached status
+func PollOnce(deadline time.Duration) {
+	devices, err := repository.GetAll()
+	if err != nil {
+		log.Printf("Health poller: failed to fetch devices: %v", err)
+		return
+	}
+
+	healthy, skipped := 0, 0
+	for _, status := range CheckAllWithin(context.Background(), devices, deadline) {
+		switch status.Status {
+		case "healthy":
+			healthy++
+		case "unknown":
+			if status.Error == "health check deadline exceeded" {
+				skipped++
+			}
+		}
+	}
+
+	if skipped > 0 {
+		log.Printf("Health poller: %d/%d devices healthy, %d not checked within %s", healthy, len(devices), skipped, deadline)
+		return
+	}
+	log.Printf("Health poller: %d/%d devices healthy", healthy, len(devices))
+}
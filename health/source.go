@@ -0,0 +1,40 @@
+package health
+
+import (
+	"edge-metrics-server/models"
+	"edge-metrics-server/repository"
+)
+
+// DeviceSource serves registered devices with their cached health status
+// (implements kubernetes.DeviceSource)
+type DeviceSource struct{}
+
+// NewDeviceSource creates a device source backed by the repository and the health cache
+func NewDeviceSource() *DeviceSource {
+	return &DeviceSource{}
+}
+
+// ListDevices returns all registered devices with their cached health status
+func (s *DeviceSource) ListDevices() ([]models.DeviceStatus, error) {
+	devices, err := repository.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return CachedStatuses(devices)
+}
+
+// GetDevice returns a device with its cached health status, or nil if it is not registered
+func (s *DeviceSource) GetDevice(deviceID string) (*models.DeviceStatus, error) {
+	device, err := repository.GetByDeviceID(deviceID)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	cached, err := repository.GetHealth(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := FromCache(*device, cached)
+	return &status, nil
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -14,6 +15,9 @@ import (
 
 var clientset *kubernetes.Clientset
 
+// dynamicClient is used for CRDs without typed clients (Prometheus Operator objects)
+var dynamicClient dynamic.Interface
+
 // InitClient initializes the Kubernetes client
 // Tries in-cluster config first, then falls back to kubeconfig
 func InitClient() error {
@@ -37,6 +41,12 @@ func InitClient() error {
 		return fmt.Errorf("failed to create Kubernetes clientset: %w", err)
 	}
 
+	dynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		clientset = nil
+		return fmt.Errorf("failed to create Kubernetes dynamic client: %w", err)
+	}
+
 	return nil
 }
 
@@ -45,11 +55,25 @@ func GetClientset() *kubernetes.Clientset {
 	return clientset
 }
 
+// GetDynamicClient returns the initialized dynamic client
+func GetDynamicClient() dynamic.Interface {
+	return dynamicClient
+}
+
 // IsInitialized checks if the Kubernetes client is initialized
 func IsInitialized() bool {
 	return clientset != nil
 }
 
+// GetNamespace returns the namespace edge device resources are managed in
+// (KUBERNETES_NAMESPACE, default "monitoring")
+func GetNamespace() string {
+	if namespace := os.Getenv("KUBERNETES_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	return "monitoring"
+}
+
 // HealthCheckResponse represents K8s health check result
 type HealthCheckResponse struct {
 	KubernetesAvailable bool              `json:"kubernetes_available"`
@@ -99,5 +123,13 @@ func CheckHealth(namespace string) (*HealthCheckResponse, error) {
 		response.RBACPermissions["endpoints"] = "ok"
 	}
 
+	// Check EndpointSlices permissions
+	_, err = clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		response.RBACPermissions["endpointslices"] = fmt.Sprintf("error: %v", err)
+	} else {
+		response.RBACPermissions["endpointslices"] = "ok"
+	}
+
 	return response, nil
 }
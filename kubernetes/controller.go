@@ -0,0 +1,412 @@
+package kubernetes
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// maxReconcileErrors is the number of recent reconcile errors kept for /kubernetes/status
+const maxReconcileErrors = 20
+
+// ControllerStatus represents the state of the reconciliation controller
+type ControllerStatus struct {
+	Enabled           bool             `json:"enabled"`
+	Namespace         string           `json:"namespace,omitempty"`
+	Interval          string           `json:"interval,omitempty"`
+	LastFullReconcile string           `json:"last_full_reconcile,omitempty"`
+	LastReconcile     string           `json:"last_reconcile,omitempty"`
+	Reconciles        int64            `json:"reconciles"`
+	Failures          int64            `json:"failures"`
+	QueueLength       int              `json:"queue_length"`
+	LastErrors        []ReconcileError `json:"last_errors"`
+}
+
+// ReconcileError represents a failed reconcile of a single device
+type ReconcileError struct {
+	DeviceID string `json:"device_id"`
+	Error    string `json:"error"`
+	Time     string `json:"time"`
+}
+
+// controller reconciles edge device Services/Endpoints/EndpointSlices towards the registered devices
+type controller struct {
+	namespace string
+	interval  time.Duration
+
+	queue               workqueue.TypedRateLimitingInterface[string]
+	serviceLister       corelisters.ServiceLister
+	endpointsLister     corelisters.EndpointsLister
+	endpointSliceLister discoverylisters.EndpointSliceLister
+
+	mu                sync.Mutex
+	lastFullReconcile time.Time
+	lastReconcile     time.Time
+	reconciles        int64
+	failures          int64
+	lastErrors        []ReconcileError
+}
+
+var activeController *controller
+
+// StartController starts the in-process reconciliation controller
+// Managed Services/Endpoints/EndpointSlices are watched so manual edits or deletions are reverted,
+// and all devices are reconciled every interval
+func StartController(namespace string, interval time.Duration) error {
+	if !IsInitialized() {
+		return fmt.Errorf("kubernetes client not initialized")
+	}
+	if activeController != nil {
+		return fmt.Errorf("controller already running")
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(GetClientset(), 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = "managed_by=edge-metrics-server"
+		}),
+	)
+	serviceInformer := factory.Core().V1().Services()
+	endpointsInformer := factory.Core().V1().Endpoints()
+
+	c := &controller{
+		namespace:       namespace,
+		interval:        interval,
+		queue:           workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		serviceLister:   serviceInformer.Lister(),
+		endpointsLister: endpointsInformer.Lister(),
+		lastErrors:      []ReconcileError{},
+	}
+	synced := []cache.InformerSynced{
+		serviceInformer.Informer().HasSynced,
+		endpointsInformer.Informer().HasSynced,
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, obj interface{}) { c.enqueueObject(obj) },
+		DeleteFunc: c.enqueueObject,
+	}
+	if _, err := serviceInformer.Informer().AddEventHandler(handler); err != nil {
+		return err
+	}
+	if _, err := endpointsInformer.Informer().AddEventHandler(handler); err != nil {
+		return err
+	}
+	// EndpointSlices are only watched when managed, legacy mode does not need RBAC for them
+	if managesEndpointSlices() {
+		endpointSliceInformer := factory.Discovery().V1().EndpointSlices()
+		c.endpointSliceLister = endpointSliceInformer.Lister()
+		if _, err := endpointSliceInformer.Informer().AddEventHandler(handler); err != nil {
+			return err
+		}
+		synced = append(synced, endpointSliceInformer.Informer().HasSynced)
+	}
+
+	stopCh := make(chan struct{})
+	factory.Start(stopCh)
+
+	go func() {
+		if !cache.WaitForCacheSync(stopCh, synced...) {
+			log.Printf("Kubernetes controller: failed to sync informer caches")
+			return
+		}
+
+		go c.runWorker()
+
+		c.enqueueAll()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			c.enqueueAll()
+		}
+	}()
+
+	activeController = c
+	log.Printf("Kubernetes controller started (namespace: %s, interval: %s, endpoints mode: %s)", namespace, interval, GetEndpointsMode())
+	return nil
+}
+
+// RequestReconcile queues a device for reconciliation if the controller is running
+func RequestReconcile(deviceID string) {
+	if activeController != nil {
+		activeController.queue.Add(deviceID)
+	}
+}
+
+// GetControllerStatus returns the current controller state
+func GetControllerStatus() *ControllerStatus {
+	c := activeController
+	if c == nil {
+		return &ControllerStatus{Enabled: false, LastErrors: []ReconcileError{}}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := &ControllerStatus{
+		Enabled:     true,
+		Namespace:   c.namespace,
+		Interval:    c.interval.String(),
+		Reconciles:  c.reconciles,
+		Failures:    c.failures,
+		QueueLength: c.queue.Len(),
+		LastErrors:  append([]ReconcileError{}, c.lastErrors...),
+	}
+	if !c.lastFullReconcile.IsZero() {
+		status.LastFullReconcile = c.lastFullReconcile.Format(time.RFC3339)
+	}
+	if !c.lastReconcile.IsZero() {
+		status.LastReconcile = c.lastReconcile.Format(time.RFC3339)
+	}
+	return status
+}
+
+// enqueueObject queues the device owning a managed Service/Endpoints/EndpointSlice object
+func (c *controller) enqueueObject(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	meta, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+
+	if deviceID := meta.GetLabels()["device_id"]; deviceID != "" {
+		c.queue.Add(deviceID)
+		return
+	}
+	if strings.HasPrefix(meta.GetName(), "edge-device-") {
+		c.queue.Add(strings.TrimPrefix(meta.GetName(), "edge-device-"))
+	}
+}
+
+// enqueueAll queues every registered device and every managed object
+func (c *controller) enqueueAll() {
+	devices, err := getAllDevices()
+	if err != nil {
+		c.recordError("", err)
+		return
+	}
+	for _, device := range devices {
+		c.queue.Add(device.DeviceID)
+	}
+
+	services, _ := c.serviceLister.Services(c.namespace).List(labels.Everything())
+	for _, service := range services {
+		c.enqueueObject(service)
+	}
+	endpoints, _ := c.endpointsLister.Endpoints(c.namespace).List(labels.Everything())
+	for _, ep := range endpoints {
+		c.enqueueObject(ep)
+	}
+	if c.endpointSliceLister != nil {
+		slices, _ := c.endpointSliceLister.EndpointSlices(c.namespace).List(labels.Everything())
+		for _, slice := range slices {
+			c.enqueueObject(slice)
+		}
+	}
+
+	c.mu.Lock()
+	c.lastFullReconcile = time.Now()
+	c.mu.Unlock()
+}
+
+// runWorker processes queued devices until the queue is shut down
+func (c *controller) runWorker() {
+	for {
+		deviceID, shutdown := c.queue.Get()
+		if shutdown {
+			return
+		}
+
+		err := c.reconcile(deviceID)
+
+		c.mu.Lock()
+		c.reconciles++
+		c.lastReconcile = time.Now()
+		c.mu.Unlock()
+
+		if err != nil {
+			log.Printf("Kubernetes controller: reconcile %s failed: %v", deviceID, err)
+			c.recordError(deviceID, err)
+			c.queue.AddRateLimited(deviceID)
+		} else {
+			c.queue.Forget(deviceID)
+		}
+		c.queue.Done(deviceID)
+	}
+}
+
+// reconcile makes the Service/Endpoints/EndpointSlice of a device match its registered state
+// Healthy, approved devices with an IP address get a Service and the endpoint
+// resources of the endpoints mode (in notready mode unhealthy devices keep them
+// with a not-ready address during the grace period), everything else is removed.
+// Objects are only written when they differ.
+func (c *controller) reconcile(deviceID string) error {
+	source, err := getDeviceSource()
+	if err != nil {
+		return err
+	}
+
+	device, err := source.GetDevice(deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+
+	name := fmt.Sprintf("edge-device-%s", strings.ToLower(deviceID))
+
+	service, err := c.serviceLister.Services(c.namespace).Get(name)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if errors.IsNotFound(err) {
+		service = nil
+	}
+
+	endpoints, err := c.endpointsLister.Endpoints(c.namespace).Get(name)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if errors.IsNotFound(err) {
+		endpoints = nil
+	}
+
+	var slice *discoveryv1.EndpointSlice
+	if c.endpointSliceLister != nil {
+		slice, err = c.endpointSliceLister.EndpointSlices(c.namespace).Get(name)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if errors.IsNotFound(err) {
+			slice = nil
+		}
+	}
+
+	expose, ready := false, false
+	if device != nil && device.IPAddress != "" {
+		expose, ready = deviceExposure(*device, time.Now())
+	}
+
+	if !expose {
+		if service != nil {
+			if err := DeleteService(c.namespace, deviceID); err != nil {
+				return fmt.Errorf("delete service: %w", err)
+			}
+			log.Printf("Kubernetes controller: deleted service %s", name)
+		}
+		if endpoints != nil {
+			if err := DeleteEndpoints(c.namespace, deviceID); err != nil {
+				return fmt.Errorf("delete endpoints: %w", err)
+			}
+		}
+		if slice != nil {
+			if err := DeleteEndpointSlice(c.namespace, deviceID); err != nil {
+				return fmt.Errorf("delete endpointslice: %w", err)
+			}
+		}
+		return nil
+	}
+
+	desired := desiredService(c.namespace, device.DeviceID, device.DeviceType, device.Port, device.Labels)
+	if service == nil || !serviceInSync(service, desired) {
+		if err := CreateOrUpdateService(c.namespace, device.DeviceID, device.DeviceType, device.Port, device.Labels); err != nil {
+			return fmt.Errorf("service: %w", err)
+		}
+		log.Printf("Kubernetes controller: reconciled service %s", name)
+	}
+
+	if managesEndpoints() {
+		desiredEp := desiredEndpoints(c.namespace, device.DeviceID, device.IPAddress, device.Port, ready)
+		if endpoints == nil || !endpointsInSync(endpoints, desiredEp) {
+			if err := CreateOrUpdateEndpoints(c.namespace, device.DeviceID, device.IPAddress, device.Port, ready); err != nil {
+				return fmt.Errorf("endpoints: %w", err)
+			}
+			log.Printf("Kubernetes controller: reconciled endpoints %s", name)
+		}
+	} else if endpoints != nil {
+		if err := DeleteEndpoints(c.namespace, deviceID); err != nil {
+			return fmt.Errorf("delete endpoints: %w", err)
+		}
+	}
+
+	if managesEndpointSlices() {
+		desiredSlice := desiredEndpointSlice(c.namespace, device.DeviceID, device.IPAddress, device.Port, ready)
+		if slice == nil || !endpointSliceInSync(slice, desiredSlice) {
+			if err := CreateOrUpdateEndpointSlice(c.namespace, device.DeviceID, device.IPAddress, device.Port, ready); err != nil {
+				return fmt.Errorf("endpointslice: %w", err)
+			}
+			log.Printf("Kubernetes controller: reconciled endpointslice %s", name)
+		}
+	} else if slice != nil {
+		if err := DeleteEndpointSlice(c.namespace, deviceID); err != nil {
+			return fmt.Errorf("delete endpointslice: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// recordError keeps the most recent reconcile errors
+func (c *controller) recordError(deviceID string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures++
+	c.lastErrors = append(c.lastErrors, ReconcileError{
+		DeviceID: deviceID,
+		Error:    err.Error(),
+		Time:     time.Now().Format(time.RFC3339),
+	})
+	if len(c.lastErrors) > maxReconcileErrors {
+		c.lastErrors = c.lastErrors[len(c.lastErrors)-maxReconcileErrors:]
+	}
+}
+
+// serviceInSync reports whether an existing Service matches the desired one
+// Labels must match exactly so that removed device labels are dropped
+func serviceInSync(actual, desired *corev1.Service) bool {
+	return equality.Semantic.DeepEqual(actual.Labels, desired.Labels) &&
+		actual.Spec.ClusterIP == desired.Spec.ClusterIP &&
+		equality.Semantic.DeepEqual(actual.Spec.Ports, desired.Spec.Ports)
+}
+
+// endpointsInSync reports whether an existing Endpoints object matches the desired one
+// The skip-mirror label is compared both ways so mirroring resumes when leaving "both" mode
+func endpointsInSync(actual, desired *corev1.Endpoints) bool {
+	return hasLabels(actual.Labels, desired.Labels) &&
+		actual.Labels[discoveryv1.LabelSkipMirror] == desired.Labels[discoveryv1.LabelSkipMirror] &&
+		equality.Semantic.DeepEqual(actual.Subsets, desired.Subsets)
+}
+
+// endpointSliceInSync reports whether an existing EndpointSlice matches the desired one
+func endpointSliceInSync(actual, desired *discoveryv1.EndpointSlice) bool {
+	return hasLabels(actual.Labels, desired.Labels) &&
+		actual.AddressType == desired.AddressType &&
+		equality.Semantic.DeepEqual(actual.Endpoints, desired.Endpoints) &&
+		equality.Semantic.DeepEqual(actual.Ports, desired.Ports)
+}
+
+// hasLabels reports whether labels contains all of the wanted labels
+func hasLabels(actual, wanted map[string]string) bool {
+	for key, value := range wanted {
+		if actual[key] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -4,47 +4,22 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // CreateOrUpdateEndpoints creates or updates a Kubernetes Endpoints
-func CreateOrUpdateEndpoints(namespace, deviceID, ipAddress string, port int) error {
+func CreateOrUpdateEndpoints(namespace, deviceID, ipAddress string, port int, ready bool) error {
 	if !IsInitialized() {
 		return fmt.Errorf("kubernetes client not initialized")
 	}
 
-	endpointsName := fmt.Sprintf("edge-device-%s", strings.ToLower(deviceID))
-
-	endpoints := &corev1.Endpoints{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      endpointsName,
-			Namespace: namespace,
-			Labels: map[string]string{
-				"app":        "edge-exporter",
-				"device_id":  deviceID,
-				"managed_by": "edge-metrics-server",
-			},
-		},
-		Subsets: []corev1.EndpointSubset{
-			{
-				Addresses: []corev1.EndpointAddress{
-					{
-						IP: ipAddress,
-					},
-				},
-				Ports: []corev1.EndpointPort{
-					{
-						Name:     "metrics",
-						Port:     int32(port),
-						Protocol: corev1.ProtocolTCP,
-					},
-				},
-			},
-		},
-	}
+	endpoints := desiredEndpoints(namespace, deviceID, ipAddress, port, ready)
+	endpointsName := endpoints.Name
 
 	ctx := context.Background()
 	client := GetClientset().CoreV1().Endpoints(namespace)
@@ -65,6 +40,74 @@ func CreateOrUpdateEndpoints(namespace, deviceID, ipAddress string, port int) er
 	return err
 }
 
+// desiredEndpoints builds the Endpoints of a device pointing at its IP address
+// A device that is not ready has its address in NotReadyAddresses
+func desiredEndpoints(namespace, deviceID, ipAddress string, port int, ready bool) *corev1.Endpoints {
+	endpointsName := fmt.Sprintf("edge-device-%s", strings.ToLower(deviceID))
+
+	labels := map[string]string{
+		"app":        "edge-exporter",
+		"device_id":  deviceID,
+		"managed_by": "edge-metrics-server",
+	}
+	// EndpointSlices are managed directly, don't let Kubernetes mirror a second one
+	if endpointsMode == EndpointsModeBoth {
+		labels[discoveryv1.LabelSkipMirror] = "true"
+	}
+
+	subset := corev1.EndpointSubset{
+		Ports: []corev1.EndpointPort{
+			{
+				Name:     "metrics",
+				Port:     int32(port),
+				Protocol: corev1.ProtocolTCP,
+			},
+		},
+	}
+	address := corev1.EndpointAddress{IP: ipAddress}
+	if ready {
+		subset.Addresses = []corev1.EndpointAddress{address}
+	} else {
+		subset.NotReadyAddresses = []corev1.EndpointAddress{address}
+	}
+
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      endpointsName,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Subsets: []corev1.EndpointSubset{subset},
+	}
+}
+
+// RefreshEndpoints updates the Endpoints/EndpointSlice of an already synced device with a new address
+// Devices without a Service are left alone (they are picked up by the next sync)
+// The address keeps the readiness derived from the device's cached health
+// Returns true if the Endpoints object was updated
+func RefreshEndpoints(namespace, deviceID, ipAddress string, port int) (bool, error) {
+	if !IsInitialized() {
+		return false, fmt.Errorf("kubernetes client not initialized")
+	}
+
+	if _, err := GetService(namespace, deviceID); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil // Not synced yet
+		}
+		return false, err
+	}
+
+	ready := true
+	if device, err := getDeviceByID(deviceID); err == nil {
+		_, ready = deviceExposure(*device, time.Now())
+	}
+
+	if err := ApplyDeviceEndpoints(namespace, deviceID, ipAddress, port, ready); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // DeleteEndpoints deletes a Kubernetes Endpoints
 func DeleteEndpoints(namespace, deviceID string) error {
 	if !IsInitialized() {
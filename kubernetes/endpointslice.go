@@ -0,0 +1,230 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Endpoints modes (KUBERNETES_ENDPOINTS_MODE)
+const (
+	EndpointsModeLegacy = "legacy" // core/v1 Endpoints only (mirrored to slices by Kubernetes)
+	EndpointsModeSlice  = "slice"  // discovery.k8s.io/v1 EndpointSlices only
+	EndpointsModeBoth   = "both"   // both, with mirroring of the Endpoints disabled
+)
+
+var endpointsMode = EndpointsModeLegacy
+
+// SetEndpointsMode sets which endpoint resources are managed for each device
+func SetEndpointsMode(mode string) error {
+	switch mode {
+	case EndpointsModeLegacy, EndpointsModeSlice, EndpointsModeBoth:
+		endpointsMode = mode
+		return nil
+	default:
+		return fmt.Errorf("invalid endpoints mode %q (expected legacy, slice or both)", mode)
+	}
+}
+
+// GetEndpointsMode returns the configured endpoints mode
+func GetEndpointsMode() string {
+	return endpointsMode
+}
+
+// managesEndpoints reports whether core/v1 Endpoints are managed in the current mode
+func managesEndpoints() bool {
+	return endpointsMode != EndpointsModeSlice
+}
+
+// managesEndpointSlices reports whether EndpointSlices are managed in the current mode
+func managesEndpointSlices() bool {
+	return endpointsMode != EndpointsModeLegacy
+}
+
+// ignoreSliceForbidden drops Forbidden errors for EndpointSlices in legacy mode,
+// where the RBAC role does not have to grant access to them
+func ignoreSliceForbidden(err error) error {
+	if err != nil && !managesEndpointSlices() && errors.IsForbidden(err) {
+		return nil
+	}
+	return err
+}
+
+// ApplyDeviceEndpoints points a device's endpoint resources at its IP address
+// according to the endpoints mode. Resources of the other kind are removed.
+func ApplyDeviceEndpoints(namespace, deviceID, ipAddress string, port int, ready bool) error {
+	if managesEndpoints() {
+		if err := CreateOrUpdateEndpoints(namespace, deviceID, ipAddress, port, ready); err != nil {
+			return err
+		}
+	} else if err := DeleteEndpoints(namespace, deviceID); err != nil {
+		return err
+	}
+
+	if managesEndpointSlices() {
+		if err := CreateOrUpdateEndpointSlice(namespace, deviceID, ipAddress, port, ready); err != nil {
+			return fmt.Errorf("endpointslice: %w", err)
+		}
+	} else if err := DeleteEndpointSlice(namespace, deviceID); err != nil {
+		return fmt.Errorf("endpointslice: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveDeviceEndpoints deletes both the Endpoints and the EndpointSlice of a device
+func RemoveDeviceEndpoints(namespace, deviceID string) error {
+	if err := DeleteEndpoints(namespace, deviceID); err != nil {
+		return err
+	}
+	if err := DeleteEndpointSlice(namespace, deviceID); err != nil {
+		return fmt.Errorf("endpointslice: %w", err)
+	}
+	return nil
+}
+
+// CreateOrUpdateEndpointSlice creates or updates the EndpointSlice of a device
+func CreateOrUpdateEndpointSlice(namespace, deviceID, ipAddress string, port int, ready bool) error {
+	if !IsInitialized() {
+		return fmt.Errorf("kubernetes client not initialized")
+	}
+
+	slice := desiredEndpointSlice(namespace, deviceID, ipAddress, port, ready)
+
+	ctx := context.Background()
+	client := GetClientset().DiscoveryV1().EndpointSlices(namespace)
+
+	// Try to get existing slice
+	existing, err := client.Get(ctx, slice.Name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Create new slice
+			_, err = client.Create(ctx, slice, metav1.CreateOptions{})
+			return err
+		}
+		return err
+	}
+
+	// The address type is immutable, recreate the slice if the IP family changed
+	if existing.AddressType != slice.AddressType {
+		if err := client.Delete(ctx, slice.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		_, err = client.Create(ctx, slice, metav1.CreateOptions{})
+		return err
+	}
+
+	// Update existing slice
+	slice.ResourceVersion = existing.ResourceVersion
+	_, err = client.Update(ctx, slice, metav1.UpdateOptions{})
+	return err
+}
+
+// desiredEndpointSlice builds the EndpointSlice of a device pointing at its IP address
+func desiredEndpointSlice(namespace, deviceID, ipAddress string, port int, ready bool) *discoveryv1.EndpointSlice {
+	sliceName := fmt.Sprintf("edge-device-%s", strings.ToLower(deviceID))
+
+	addressType := discoveryv1.AddressTypeIPv4
+	if ip := net.ParseIP(ipAddress); ip != nil && ip.To4() == nil {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+
+	portName := "metrics"
+	portNumber := int32(port)
+	protocol := corev1.ProtocolTCP
+
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      sliceName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":                        "edge-exporter",
+				"device_id":                  deviceID,
+				"managed_by":                 "edge-metrics-server",
+				discoveryv1.LabelServiceName: sliceName,
+				discoveryv1.LabelManagedBy:   "edge-metrics-server",
+			},
+		},
+		AddressType: addressType,
+		Endpoints: []discoveryv1.Endpoint{
+			{
+				Addresses:  []string{ipAddress},
+				Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			},
+		},
+		Ports: []discoveryv1.EndpointPort{
+			{
+				Name:     &portName,
+				Port:     &portNumber,
+				Protocol: &protocol,
+			},
+		},
+	}
+}
+
+// DeleteEndpointSlice deletes the EndpointSlice of a device
+func DeleteEndpointSlice(namespace, deviceID string) error {
+	if !IsInitialized() {
+		return fmt.Errorf("kubernetes client not initialized")
+	}
+
+	sliceName := fmt.Sprintf("edge-device-%s", strings.ToLower(deviceID))
+	ctx := context.Background()
+	client := GetClientset().DiscoveryV1().EndpointSlices(namespace)
+
+	err := client.Delete(ctx, sliceName, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil // Already deleted
+	}
+	return ignoreSliceForbidden(err)
+}
+
+// GetEndpointSlice gets the EndpointSlice of a device
+func GetEndpointSlice(namespace, deviceID string) (*discoveryv1.EndpointSlice, error) {
+	if !IsInitialized() {
+		return nil, fmt.Errorf("kubernetes client not initialized")
+	}
+
+	sliceName := fmt.Sprintf("edge-device-%s", strings.ToLower(deviceID))
+	ctx := context.Background()
+	client := GetClientset().DiscoveryV1().EndpointSlices(namespace)
+
+	slice, err := client.Get(ctx, sliceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return slice, nil
+}
+
+// ListEdgeEndpointSlices lists all edge-device-* EndpointSlices in a namespace
+func ListEdgeEndpointSlices(namespace string) ([]string, error) {
+	if !IsInitialized() {
+		return nil, fmt.Errorf("kubernetes client not initialized")
+	}
+
+	ctx := context.Background()
+	client := GetClientset().DiscoveryV1().EndpointSlices(namespace)
+
+	listOptions := metav1.ListOptions{
+		LabelSelector: "managed_by=edge-metrics-server",
+	}
+
+	sliceList, err := client.List(ctx, listOptions)
+	if err != nil {
+		return nil, ignoreSliceForbidden(err)
+	}
+
+	var sliceNames []string
+	for _, slice := range sliceList.Items {
+		sliceNames = append(sliceNames, slice.Name)
+	}
+
+	return sliceNames, nil
+}
@@ -0,0 +1,472 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"edge-metrics-server/models"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// Prometheus Operator object kinds (PROMETHEUS_MONITOR_KIND)
+const (
+	MonitorKindServiceMonitor = "servicemonitor" // one ServiceMonitor per device type, selecting the device Services
+	MonitorKindScrapeConfig   = "scrapeconfig"   // one ScrapeConfig per device type, with static device targets
+)
+
+// Defaults for device types without stored scrape settings
+const (
+	DefaultScrapeInterval = "30s"
+	DefaultMetricsPath    = "/metrics"
+)
+
+var (
+	serviceMonitorGVR = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "servicemonitors"}
+	scrapeConfigGVR   = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1alpha1", Resource: "scrapeconfigs"}
+)
+
+var (
+	monitorKind   = MonitorKindServiceMonitor
+	monitorLabels = map[string]string{"release": "monitoring"}
+)
+
+var (
+	monitorSyncMu     sync.Mutex
+	monitorNamespaces = map[string]bool{} // Namespaces monitors were synced to
+	scrapeSettings    func() ([]models.ScrapeSettings, error)
+	monitorTrigger    = make(chan struct{}, 1)
+)
+
+// MonitorResult represents the result of applying a single monitor object
+type MonitorResult struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind,omitempty"` // Only set for objects of the other kind
+	DeviceType string `json:"device_type,omitempty"`
+	Status     string `json:"status"` // created, updated, deleted, failed
+	Error      string `json:"error,omitempty"`
+}
+
+// MonitorSyncResponse represents the response from a monitor sync operation
+type MonitorSyncResponse struct {
+	Status    string          `json:"status"`
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace"`
+	Created   []MonitorResult `json:"created"`
+	Updated   []MonitorResult `json:"updated"`
+	Deleted   []MonitorResult `json:"deleted"`
+	Failed    []MonitorResult `json:"failed"`
+}
+
+// SetMonitorKind sets which Prometheus Operator object is generated per device type
+func SetMonitorKind(kind string) error {
+	switch kind {
+	case MonitorKindServiceMonitor, MonitorKindScrapeConfig:
+		monitorKind = kind
+		return nil
+	default:
+		return fmt.Errorf("invalid monitor kind %q (expected servicemonitor or scrapeconfig)", kind)
+	}
+}
+
+// GetMonitorKind returns the configured monitor kind
+func GetMonitorKind() string {
+	return monitorKind
+}
+
+// SetMonitorLabels sets extra labels put on generated monitor objects
+// (typically the label the Prometheus monitor selector matches on)
+func SetMonitorLabels(labels map[string]string) {
+	monitorLabels = labels
+}
+
+// BuildMonitors generates one monitor object of the configured kind per device
+// type of the approved devices. Device types without stored settings use the defaults.
+func BuildMonitors(namespace string, settings []models.ScrapeSettings) ([]*unstructured.Unstructured, error) {
+	devices, err := getAllDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+
+	settingsMap := make(map[string]models.ScrapeSettings)
+	for _, s := range settings {
+		settingsMap[s.DeviceType] = s
+	}
+
+	// Group approved devices by type
+	devicesByType := make(map[string][]models.DeviceStatus)
+	for _, device := range devices {
+		if device.IsApproved() {
+			devicesByType[device.DeviceType] = append(devicesByType[device.DeviceType], device)
+		}
+	}
+
+	deviceTypes := make([]string, 0, len(devicesByType))
+	for deviceType := range devicesByType {
+		deviceTypes = append(deviceTypes, deviceType)
+	}
+	sort.Strings(deviceTypes)
+
+	var objects []*unstructured.Unstructured
+	for _, deviceType := range deviceTypes {
+		s, ok := settingsMap[deviceType]
+		if !ok {
+			s = models.ScrapeSettings{DeviceType: deviceType}
+		}
+		if s.Interval == "" {
+			s.Interval = DefaultScrapeInterval
+		}
+		if s.MetricsPath == "" {
+			s.MetricsPath = DefaultMetricsPath
+		}
+
+		if monitorKind == MonitorKindScrapeConfig {
+			objects = append(objects, desiredScrapeConfig(namespace, s, devicesByType[deviceType]))
+		} else {
+			objects = append(objects, desiredServiceMonitor(namespace, s))
+		}
+	}
+
+	return objects, nil
+}
+
+// MonitorsToYAML renders monitor objects as a multi-document YAML string
+func MonitorsToYAML(objects []*unstructured.Unstructured) (string, error) {
+	var out strings.Builder
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString("---\n")
+		out.Write(data)
+	}
+	return out.String(), nil
+}
+
+// SetScrapeSettingsSource sets where the scrape settings for background monitor
+// resyncs are read from, and starts the resync worker
+func SetScrapeSettingsSource(source func() ([]models.ScrapeSettings, error)) {
+	if scrapeSettings == nil {
+		go runMonitorResync()
+	}
+	scrapeSettings = source
+}
+
+// RequestMonitorResync re-applies the ScrapeConfigs after a device changed,
+// since their static targets contain the device IPs and approval state.
+// ServiceMonitors select Services and need no resync. Calls are coalesced.
+func RequestMonitorResync() {
+	if monitorKind != MonitorKindScrapeConfig || scrapeSettings == nil || !IsInitialized() {
+		return
+	}
+
+	select {
+	case monitorTrigger <- struct{}{}:
+	default: // A resync is already pending
+	}
+}
+
+// runMonitorResync resyncs the monitors whenever a resync is requested
+// Only namespaces that already contain managed monitors are resynced.
+func runMonitorResync() {
+	for range monitorTrigger {
+		settings, err := scrapeSettings()
+		if err != nil {
+			log.Printf("Monitor resync: failed to get scrape settings: %v", err)
+			continue
+		}
+
+		monitorSyncMu.Lock()
+		namespaces := map[string]bool{GetNamespace(): true}
+		for namespace := range monitorNamespaces {
+			namespaces[namespace] = true
+		}
+		monitorSyncMu.Unlock()
+
+		for namespace := range namespaces {
+			list, err := GetDynamicClient().Resource(monitorGVR()).Namespace(namespace).List(context.Background(),
+				metav1.ListOptions{LabelSelector: "managed_by=edge-metrics-server"})
+			if err != nil || len(list.Items) == 0 {
+				continue
+			}
+
+			result, err := SyncMonitors(namespace, settings)
+			if err != nil {
+				log.Printf("Monitor resync of %s failed: %v", namespace, err)
+				continue
+			}
+			for _, failed := range result.Failed {
+				log.Printf("Monitor resync of %s: %s failed: %s", namespace, failed.Name, failed.Error)
+			}
+		}
+	}
+}
+
+// SyncMonitors applies the generated monitor objects to a namespace and deletes
+// managed objects that are no longer generated, including all managed objects of
+// the other kind (left over from a PROMETHEUS_MONITOR_KIND switch)
+func SyncMonitors(namespace string, settings []models.ScrapeSettings) (*MonitorSyncResponse, error) {
+	if !IsInitialized() {
+		return nil, fmt.Errorf("kubernetes client not initialized")
+	}
+
+	monitorSyncMu.Lock()
+	defer monitorSyncMu.Unlock()
+
+	objects, err := BuildMonitors(namespace, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &MonitorSyncResponse{
+		Status:    "synced",
+		Kind:      monitorKind,
+		Namespace: namespace,
+		Created:   []MonitorResult{},
+		Updated:   []MonitorResult{},
+		Deleted:   []MonitorResult{},
+		Failed:    []MonitorResult{},
+	}
+
+	ctx := context.Background()
+	client := GetDynamicClient().Resource(monitorGVR()).Namespace(namespace)
+
+	desired := make(map[string]bool)
+	for _, obj := range objects {
+		desired[obj.GetName()] = true
+		result := MonitorResult{
+			Name:       obj.GetName(),
+			DeviceType: obj.GetLabels()["device_type"],
+		}
+
+		existing, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			result.Status = "failed"
+			result.Error = err.Error()
+			response.Failed = append(response.Failed, result)
+			continue
+		}
+
+		if errors.IsNotFound(err) {
+			_, err = client.Create(ctx, obj, metav1.CreateOptions{})
+			result.Status = "created"
+		} else {
+			obj.SetResourceVersion(existing.GetResourceVersion())
+			_, err = client.Update(ctx, obj, metav1.UpdateOptions{})
+			result.Status = "updated"
+		}
+
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			response.Failed = append(response.Failed, result)
+		} else if result.Status == "created" {
+			response.Created = append(response.Created, result)
+		} else {
+			response.Updated = append(response.Updated, result)
+		}
+	}
+
+	// Delete monitors of device types that no longer have devices
+	if err := deleteStaleMonitors(ctx, namespace, monitorGVR(), "", desired, response); err != nil {
+		return nil, err
+	}
+
+	// Delete all monitors of the other kind
+	otherKind, otherGVR := MonitorKindServiceMonitor, serviceMonitorGVR
+	if monitorKind == MonitorKindServiceMonitor {
+		otherKind, otherGVR = MonitorKindScrapeConfig, scrapeConfigGVR
+	}
+	if err := deleteStaleMonitors(ctx, namespace, otherGVR, otherKind, nil, response); err != nil {
+		return nil, err
+	}
+
+	monitorNamespaces[namespace] = true
+	return response, nil
+}
+
+// deleteStaleMonitors deletes the managed monitors of a resource that are not desired
+// A resource whose CRD is not installed has nothing to delete.
+func deleteStaleMonitors(ctx context.Context, namespace string, gvr schema.GroupVersionResource, kind string, desired map[string]bool, response *MonitorSyncResponse) error {
+	client := GetDynamicClient().Resource(gvr).Namespace(namespace)
+
+	list, err := client.List(ctx, metav1.ListOptions{LabelSelector: "managed_by=edge-metrics-server"})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+	}
+
+	for _, item := range list.Items {
+		if desired[item.GetName()] {
+			continue
+		}
+
+		result := MonitorResult{
+			Name:       item.GetName(),
+			Kind:       kind,
+			DeviceType: item.GetLabels()["device_type"],
+			Status:     "deleted",
+		}
+		if err := client.Delete(ctx, item.GetName(), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			result.Status = "failed"
+			result.Error = err.Error()
+			response.Failed = append(response.Failed, result)
+			continue
+		}
+		response.Deleted = append(response.Deleted, result)
+	}
+
+	return nil
+}
+
+// monitorGVR returns the resource of the configured monitor kind
+func monitorGVR() schema.GroupVersionResource {
+	if monitorKind == MonitorKindScrapeConfig {
+		return scrapeConfigGVR
+	}
+	return serviceMonitorGVR
+}
+
+// monitorName returns the object name for a device type (edge-devices-{device_type})
+func monitorName(deviceType string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(deviceType))
+	return fmt.Sprintf("edge-devices-%s", strings.Trim(name, "-"))
+}
+
+// monitorMetadata builds the metadata shared by all generated monitor objects
+func monitorMetadata(namespace, deviceType string) map[string]interface{} {
+	labels := map[string]interface{}{
+		"app":         "edge-metrics",
+		"device_type": deviceType,
+		"managed_by":  "edge-metrics-server",
+	}
+	for k, v := range monitorLabels {
+		labels[k] = v
+	}
+
+	return map[string]interface{}{
+		"name":      monitorName(deviceType),
+		"namespace": namespace,
+		"labels":    labels,
+	}
+}
+
+// desiredServiceMonitor builds the ServiceMonitor selecting the Services of a device type
+// device_id and device_type are copied from the Service labels onto every series
+func desiredServiceMonitor(namespace string, settings models.ScrapeSettings) *unstructured.Unstructured {
+	relabelings := []models.RelabelConfig{
+		{SourceLabels: []string{"__meta_kubernetes_service_label_device_id"}, TargetLabel: "device_id"},
+		{SourceLabels: []string{"__meta_kubernetes_service_label_device_type"}, TargetLabel: "device_type"},
+	}
+	relabelings = append(relabelings, settings.Relabelings...)
+
+	endpoint := map[string]interface{}{
+		"port":        "metrics",
+		"path":        settings.MetricsPath,
+		"interval":    settings.Interval,
+		"relabelings": relabelConfigs(relabelings),
+	}
+	if settings.ScrapeTimeout != "" {
+		endpoint["scrapeTimeout"] = settings.ScrapeTimeout
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       "ServiceMonitor",
+		"metadata":   monitorMetadata(namespace, settings.DeviceType),
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{
+					"app":         "edge-exporter",
+					"device_type": settings.DeviceType,
+				},
+			},
+			"endpoints": []interface{}{endpoint},
+		},
+	}}
+}
+
+// desiredScrapeConfig builds the ScrapeConfig scraping the devices of a type directly
+// Every device with an IP address becomes a static target labelled with device_id/device_type
+func desiredScrapeConfig(namespace string, settings models.ScrapeSettings, devices []models.DeviceStatus) *unstructured.Unstructured {
+	staticConfigs := []interface{}{}
+	for _, device := range devices {
+		if device.IPAddress == "" {
+			continue
+		}
+		staticConfigs = append(staticConfigs, map[string]interface{}{
+			"targets": []interface{}{fmt.Sprintf("%s:%d", device.IPAddress, device.Port)},
+			"labels": map[string]interface{}{
+				"device_id":   device.DeviceID,
+				"device_type": device.DeviceType,
+			},
+		})
+	}
+
+	spec := map[string]interface{}{
+		"scrapeInterval": settings.Interval,
+		"metricsPath":    settings.MetricsPath,
+		"staticConfigs":  staticConfigs,
+	}
+	if settings.ScrapeTimeout != "" {
+		spec["scrapeTimeout"] = settings.ScrapeTimeout
+	}
+	if len(settings.Relabelings) > 0 {
+		spec["relabelings"] = relabelConfigs(settings.Relabelings)
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1alpha1",
+		"kind":       "ScrapeConfig",
+		"metadata":   monitorMetadata(namespace, settings.DeviceType),
+		"spec":       spec,
+	}}
+}
+
+// relabelConfigs converts relabel rules to Prometheus Operator RelabelConfig objects
+func relabelConfigs(relabelings []models.RelabelConfig) []interface{} {
+	configs := make([]interface{}, 0, len(relabelings))
+	for _, r := range relabelings {
+		config := map[string]interface{}{}
+		if len(r.SourceLabels) > 0 {
+			sourceLabels := make([]interface{}, 0, len(r.SourceLabels))
+			for _, label := range r.SourceLabels {
+				sourceLabels = append(sourceLabels, label)
+			}
+			config["sourceLabels"] = sourceLabels
+		}
+		if r.Separator != "" {
+			config["separator"] = r.Separator
+		}
+		if r.TargetLabel != "" {
+			config["targetLabel"] = r.TargetLabel
+		}
+		if r.Regex != "" {
+			config["regex"] = r.Regex
+		}
+		if r.Replacement != "" {
+			config["replacement"] = r.Replacement
+		}
+		if r.Action != "" {
+			config["action"] = r.Action
+		}
+		configs = append(configs, config)
+	}
+	return configs
+}
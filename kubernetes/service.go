@@ -11,37 +11,45 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// reservedLabels are the Service labels set by the server (device labels cannot override them)
+var reservedLabels = map[string]bool{
+	"app":         true,
+	"device_id":   true,
+	"device_type": true,
+	"managed_by":  true,
+}
+
+// IsReservedLabel reports whether a label key is managed by the server
+func IsReservedLabel(key string) bool {
+	return reservedLabels[key]
+}
+
+// ServiceLabels returns the labels of a device Service: the device labels
+// plus the labels managed by the server
+func ServiceLabels(deviceID, deviceType string, labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels)+len(reservedLabels))
+	for key, value := range labels {
+		if !reservedLabels[key] {
+			result[key] = value
+		}
+	}
+
+	result["app"] = "edge-exporter"
+	result["device_id"] = deviceID
+	result["device_type"] = deviceType
+	result["managed_by"] = "edge-metrics-server"
+
+	return result
+}
+
 // CreateOrUpdateService creates or updates a Kubernetes Service
-func CreateOrUpdateService(namespace, deviceID, deviceType string, port int) error {
+func CreateOrUpdateService(namespace, deviceID, deviceType string, port int, labels map[string]string) error {
 	if !IsInitialized() {
 		return fmt.Errorf("kubernetes client not initialized")
 	}
 
-	serviceName := fmt.Sprintf("edge-device-%s", strings.ToLower(deviceID))
-
-	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      serviceName,
-			Namespace: namespace,
-			Labels: map[string]string{
-				"app":         "edge-exporter",
-				"device_id":   deviceID,
-				"device_type": deviceType,
-				"managed_by":  "edge-metrics-server",
-			},
-		},
-		Spec: corev1.ServiceSpec{
-			ClusterIP: "None", // Headless service
-			Ports: []corev1.ServicePort{
-				{
-					Name:       "metrics",
-					Port:       int32(port),
-					TargetPort: intstr.FromInt(port),
-					Protocol:   corev1.ProtocolTCP,
-				},
-			},
-		},
-	}
+	service := desiredService(namespace, deviceID, deviceType, port, labels)
+	serviceName := service.Name
 
 	ctx := context.Background()
 	client := GetClientset().CoreV1().Services(namespace)
@@ -62,6 +70,30 @@ func CreateOrUpdateService(namespace, deviceID, deviceType string, port int) err
 	return err
 }
 
+// desiredService builds the headless Service of a device
+func desiredService(namespace, deviceID, deviceType string, port int, labels map[string]string) *corev1.Service {
+	serviceName := fmt.Sprintf("edge-device-%s", strings.ToLower(deviceID))
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceName,
+			Namespace: namespace,
+			Labels:    ServiceLabels(deviceID, deviceType, labels),
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "None", // Headless service
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "metrics",
+					Port:       int32(port),
+					TargetPort: intstr.FromInt(port),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+}
+
 // DeleteService deletes a Kubernetes Service
 func DeleteService(namespace, deviceID string) error {
 	if !IsInitialized() {
@@ -0,0 +1,30 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"edge-metrics-server/models"
+)
+
+// DeviceSource provides the registered devices and their cached health to the sync logic
+type DeviceSource interface {
+	// ListDevices returns all registered devices with their health status
+	ListDevices() ([]models.DeviceStatus, error)
+	// GetDevice returns a single device, or nil if it is not registered
+	GetDevice(deviceID string) (*models.DeviceStatus, error)
+}
+
+var deviceSource DeviceSource
+
+// SetDeviceSource sets the source sync and the controller read devices from
+func SetDeviceSource(source DeviceSource) {
+	deviceSource = source
+}
+
+// getDeviceSource returns the configured device source
+func getDeviceSource() (DeviceSource, error) {
+	if deviceSource == nil {
+		return nil, fmt.Errorf("device source not configured")
+	}
+	return deviceSource, nil
+}
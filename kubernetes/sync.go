@@ -1,10 +1,7 @@
 package kubernetes
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
 	"time"
 
@@ -15,7 +12,7 @@ import (
 type SyncResult struct {
 	DeviceID string `json:"device_id"`
 	Service  string `json:"service,omitempty"`
-	Status   string `json:"status"` // created, updated, failed
+	Status   string `json:"status"` // created, updated, not_ready, failed
 	Error    string `json:"error,omitempty"`
 }
 
@@ -25,18 +22,21 @@ type SyncResponse struct {
 	Created      []SyncResult `json:"created"`
 	Updated      []SyncResult `json:"updated"`
 	Deleted      []SyncResult `json:"deleted"`
+	NotReady     []SyncResult `json:"not_ready"`
 	Failed       []SyncResult `json:"failed"`
 	TotalHealthy int          `json:"total_healthy"`
 }
 
 // SyncDevices synchronizes healthy devices to Kubernetes
-func SyncDevices(namespace, serverURL string) (*SyncResponse, error) {
+// In notready mode unhealthy devices within the grace period are kept with a
+// not-ready address (see deviceExposure)
+func SyncDevices(namespace string) (*SyncResponse, error) {
 	if !IsInitialized() {
 		return nil, fmt.Errorf("kubernetes client not initialized")
 	}
 
-	// Get healthy devices from the API
-	devices, err := getHealthyDevices(serverURL)
+	// Get devices to expose from the device source
+	devices, totalHealthy, err := getExposedDevices()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get healthy devices: %w", err)
 	}
@@ -46,8 +46,9 @@ func SyncDevices(namespace, serverURL string) (*SyncResponse, error) {
 		Created:      []SyncResult{},
 		Updated:      []SyncResult{},
 		Deleted:      []SyncResult{},
+		NotReady:     []SyncResult{},
 		Failed:       []SyncResult{},
-		TotalHealthy: len(devices),
+		TotalHealthy: totalHealthy,
 	}
 
 	// Track existing services in K8s
@@ -60,7 +61,8 @@ func SyncDevices(namespace, serverURL string) (*SyncResponse, error) {
 		existingMap[svc] = true
 	}
 
-	// Create or update services for healthy devices
+	// Create or update services for exposed devices
+	now := time.Now()
 	for _, device := range devices {
 		if device.IPAddress == "" {
 			response.Failed = append(response.Failed, SyncResult{
@@ -76,7 +78,7 @@ func SyncDevices(namespace, serverURL string) (*SyncResponse, error) {
 		delete(existingMap, serviceName) // Mark as processed
 
 		// Create/Update Service
-		err := CreateOrUpdateService(namespace, device.DeviceID, device.DeviceType, device.Port)
+		err := CreateOrUpdateService(namespace, device.DeviceID, device.DeviceType, device.Port, device.Labels)
 		if err != nil {
 			response.Failed = append(response.Failed, SyncResult{
 				DeviceID: device.DeviceID,
@@ -87,8 +89,9 @@ func SyncDevices(namespace, serverURL string) (*SyncResponse, error) {
 			continue
 		}
 
-		// Create/Update Endpoints
-		err = CreateOrUpdateEndpoints(namespace, device.DeviceID, device.IPAddress, device.Port)
+		// Create/Update Endpoints and/or EndpointSlice
+		_, ready := deviceExposure(device, now)
+		err = ApplyDeviceEndpoints(namespace, device.DeviceID, device.IPAddress, device.Port, ready)
 		if err != nil {
 			response.Failed = append(response.Failed, SyncResult{
 				DeviceID: device.DeviceID,
@@ -104,7 +107,10 @@ func SyncDevices(namespace, serverURL string) (*SyncResponse, error) {
 			Service:  serviceName,
 		}
 
-		if wasExisting {
+		if !ready {
+			result.Status = "not_ready"
+			response.NotReady = append(response.NotReady, result)
+		} else if wasExisting {
 			result.Status = "updated"
 			response.Updated = append(response.Updated, result)
 		} else {
@@ -113,7 +119,7 @@ func SyncDevices(namespace, serverURL string) (*SyncResponse, error) {
 		}
 	}
 
-	// Delete services that are no longer healthy
+	// Delete services that are no longer healthy (or past the grace period)
 	for serviceName := range existingMap {
 		// Extract device_id from service name (edge-device-{device_id})
 		deviceID := serviceName[len("edge-device-"):]
@@ -129,7 +135,7 @@ func SyncDevices(namespace, serverURL string) (*SyncResponse, error) {
 			continue
 		}
 
-		err = DeleteEndpoints(namespace, deviceID)
+		err = RemoveDeviceEndpoints(namespace, deviceID)
 		if err != nil {
 			response.Failed = append(response.Failed, SyncResult{
 				DeviceID: deviceID,
@@ -150,56 +156,51 @@ func SyncDevices(namespace, serverURL string) (*SyncResponse, error) {
 	return response, nil
 }
 
-// getHealthyDevices fetches healthy devices from the server API
-func getHealthyDevices(serverURL string) ([]models.DeviceStatus, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	url := fmt.Sprintf("%s/devices", serverURL)
-	resp, err := client.Get(url)
+// getExposedDevices returns the approved devices that should have Kubernetes
+// resources, along with the number of healthy ones. These are the healthy
+// devices, plus unhealthy devices within the grace period in notready mode.
+func getExposedDevices() ([]models.DeviceStatus, int, error) {
+	devices, err := getAllDevices()
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var listResponse models.DevicesListResponse
-	if err := json.NewDecoder(resp.Body).Decode(&listResponse); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	// Filter only healthy devices
-	var healthyDevices []models.DeviceStatus
-	for _, device := range listResponse.Devices {
-		if device.Status == "healthy" {
-			healthyDevices = append(healthyDevices, device)
+	// Pending/rejected devices are never scraped
+	now := time.Now()
+	totalHealthy := 0
+	var exposedDevices []models.DeviceStatus
+	for _, device := range devices {
+		if device.Status == "healthy" && device.IsApproved() {
+			totalHealthy++
+		}
+		if expose, _ := deviceExposure(device, now); expose {
+			exposedDevices = append(exposedDevices, device)
 		}
 	}
 
-	return healthyDevices, nil
+	return exposedDevices, totalHealthy, nil
 }
 
 // SyncStatusResponse represents overall sync status
 type SyncStatusResponse struct {
 	KubernetesEnabled  bool                  `json:"kubernetes_enabled"`
 	Namespace          string                `json:"namespace"`
+	EndpointsMode      string                `json:"endpoints_mode"`
+	UnhealthyMode      string                `json:"unhealthy_mode"`
 	TotalK8sResources  int                   `json:"total_k8s_resources"`
 	TotalDevices       int                   `json:"total_registered_devices"`
 	Synced             int                   `json:"synced"`
 	Unsynced           int                   `json:"unsynced"`
 	Resources          []DeviceResourceInfo  `json:"resources"`
+	Controller         *ControllerStatus     `json:"controller"`
 }
 
 // DeviceResourceInfo represents K8s resource info for a device
 type DeviceResourceInfo struct {
-	DeviceID        string `json:"device_id"`
-	ServiceExists   bool   `json:"service_exists"`
-	EndpointsExists bool   `json:"endpoints_exists"`
+	DeviceID            string `json:"device_id"`
+	ServiceExists       bool   `json:"service_exists"`
+	EndpointsExists     bool   `json:"endpoints_exists"`
+	EndpointSliceExists bool   `json:"endpoint_slice_exists"`
 }
 
 // DeviceResourceDetail represents detailed K8s resource info for a device
@@ -207,6 +208,7 @@ type DeviceResourceDetail struct {
 	DeviceID         string              `json:"device_id"`
 	Service          ServiceInfo         `json:"service"`
 	Endpoints        EndpointsInfo       `json:"endpoints"`
+	EndpointSlice    EndpointSliceInfo   `json:"endpoint_slice"`
 	PrometheusTarget string              `json:"prometheus_target"`
 }
 
@@ -232,14 +234,23 @@ type EndpointsInfo struct {
 	NotReadyAddresses []string `json:"not_ready_addresses"`
 }
 
+// EndpointSliceInfo represents EndpointSlice resource info
+type EndpointSliceInfo struct {
+	Name              string   `json:"name"`
+	Exists            bool     `json:"exists"`
+	AddressType       string   `json:"address_type"`
+	ReadyAddresses    []string `json:"ready_addresses"`
+	NotReadyAddresses []string `json:"not_ready_addresses"`
+}
+
 // GetSyncStatus returns the current sync status
-func GetSyncStatus(namespace, serverURL string) (*SyncStatusResponse, error) {
+func GetSyncStatus(namespace string) (*SyncStatusResponse, error) {
 	if !IsInitialized() {
 		return nil, fmt.Errorf("kubernetes client not initialized")
 	}
 
-	// Get all devices from API
-	devices, err := getAllDevices(serverURL)
+	// Get all devices from the device source
+	devices, err := getAllDevices()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get devices: %w", err)
 	}
@@ -264,12 +275,25 @@ func GetSyncStatus(namespace, serverURL string) (*SyncStatusResponse, error) {
 		endpointMap[ep] = true
 	}
 
+	// List existing endpoint slices
+	slices, err := ListEdgeEndpointSlices(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list endpoint slices: %w", err)
+	}
+	sliceMap := make(map[string]bool)
+	for _, slice := range slices {
+		sliceMap[slice] = true
+	}
+
 	response := &SyncStatusResponse{
 		KubernetesEnabled: true,
 		Namespace:         namespace,
+		EndpointsMode:     GetEndpointsMode(),
+		UnhealthyMode:     GetUnhealthyMode(),
 		TotalK8sResources: len(services),
 		TotalDevices:      len(devices),
 		Resources:         []DeviceResourceInfo{},
+		Controller:        GetControllerStatus(),
 	}
 
 	synced := 0
@@ -277,15 +301,20 @@ func GetSyncStatus(namespace, serverURL string) (*SyncStatusResponse, error) {
 		serviceName := fmt.Sprintf("edge-device-%s", strings.ToLower(device.DeviceID))
 		serviceExists := serviceMap[serviceName]
 		endpointsExists := endpointMap[serviceName]
+		sliceExists := sliceMap[serviceName]
 
-		if serviceExists && endpointsExists {
+		// A device is synced when the endpoint resources of the current mode exist
+		if serviceExists &&
+			(endpointsExists || !managesEndpoints()) &&
+			(sliceExists || !managesEndpointSlices()) {
 			synced++
 		}
 
 		response.Resources = append(response.Resources, DeviceResourceInfo{
-			DeviceID:        device.DeviceID,
-			ServiceExists:   serviceExists,
-			EndpointsExists: endpointsExists,
+			DeviceID:            device.DeviceID,
+			ServiceExists:       serviceExists,
+			EndpointsExists:     endpointsExists,
+			EndpointSliceExists: sliceExists,
 		})
 	}
 
@@ -296,18 +325,27 @@ func GetSyncStatus(namespace, serverURL string) (*SyncStatusResponse, error) {
 }
 
 // SyncSingleDevice synchronizes a single device to Kubernetes
-func SyncSingleDevice(namespace, deviceID, serverURL string) (*SyncResult, error) {
+func SyncSingleDevice(namespace, deviceID string) (*SyncResult, error) {
 	if !IsInitialized() {
 		return nil, fmt.Errorf("kubernetes client not initialized")
 	}
 
-	// Get device info from API
-	device, err := getDeviceByID(serverURL, deviceID)
+	// Get device info from the device source
+	device, err := getDeviceByID(deviceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get device: %w", err)
 	}
 
-	if device.Status != "healthy" {
+	if !device.IsApproved() {
+		return &SyncResult{
+			DeviceID: deviceID,
+			Status:   "failed",
+			Error:    fmt.Sprintf("device is not approved (%s)", device.ApprovalStatus),
+		}, nil
+	}
+
+	expose, ready := deviceExposure(*device, time.Now())
+	if !expose {
 		return &SyncResult{
 			DeviceID: deviceID,
 			Status:   "failed",
@@ -336,7 +374,7 @@ func SyncSingleDevice(namespace, deviceID, serverURL string) (*SyncResult, error
 	}
 
 	// Create/Update Service
-	err = CreateOrUpdateService(namespace, device.DeviceID, device.DeviceType, device.Port)
+	err = CreateOrUpdateService(namespace, device.DeviceID, device.DeviceType, device.Port, device.Labels)
 	if err != nil {
 		return &SyncResult{
 			DeviceID: deviceID,
@@ -346,8 +384,8 @@ func SyncSingleDevice(namespace, deviceID, serverURL string) (*SyncResult, error
 		}, nil
 	}
 
-	// Create/Update Endpoints
-	err = CreateOrUpdateEndpoints(namespace, device.DeviceID, device.IPAddress, device.Port)
+	// Create/Update Endpoints and/or EndpointSlice
+	err = ApplyDeviceEndpoints(namespace, device.DeviceID, device.IPAddress, device.Port, ready)
 	if err != nil {
 		return &SyncResult{
 			DeviceID: deviceID,
@@ -358,7 +396,9 @@ func SyncSingleDevice(namespace, deviceID, serverURL string) (*SyncResult, error
 	}
 
 	status := "created"
-	if wasExisting {
+	if !ready {
+		status = "not_ready"
+	} else if wasExisting {
 		status = "updated"
 	}
 
@@ -390,6 +430,12 @@ func GetDeviceResources(namespace, deviceID string) (*DeviceResourceDetail, erro
 			ReadyAddresses:    []string{},
 			NotReadyAddresses: []string{},
 		},
+		EndpointSlice: EndpointSliceInfo{
+			Name:              serviceName,
+			Exists:            false,
+			ReadyAddresses:    []string{},
+			NotReadyAddresses: []string{},
+		},
 		PrometheusTarget: fmt.Sprintf("http://%s.%s.svc:9100/metrics", serviceName, namespace),
 	}
 
@@ -426,6 +472,29 @@ func GetDeviceResources(namespace, deviceID string) (*DeviceResourceDetail, erro
 		}
 	}
 
+	// Get EndpointSlice info
+	slice, err := GetEndpointSlice(namespace, deviceID)
+	if err == nil && slice != nil {
+		detail.EndpointSlice.Exists = true
+		detail.EndpointSlice.AddressType = string(slice.AddressType)
+		for _, endpoint := range slice.Endpoints {
+			ready := endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+			for _, addr := range endpoint.Addresses {
+				for _, port := range slice.Ports {
+					if port.Port == nil {
+						continue
+					}
+					target := fmt.Sprintf("%s:%d", addr, *port.Port)
+					if ready {
+						detail.EndpointSlice.ReadyAddresses = append(detail.EndpointSlice.ReadyAddresses, target)
+					} else {
+						detail.EndpointSlice.NotReadyAddresses = append(detail.EndpointSlice.NotReadyAddresses, target)
+					}
+				}
+			}
+		}
+	}
+
 	return detail, nil
 }
 
@@ -448,8 +517,8 @@ func DeleteDeviceResources(namespace, deviceID string) (*SyncResult, error) {
 		}, nil
 	}
 
-	// Delete Endpoints
-	err = DeleteEndpoints(namespace, deviceID)
+	// Delete Endpoints and EndpointSlice
+	err = RemoveDeviceEndpoints(namespace, deviceID)
 	if err != nil {
 		return &SyncResult{
 			DeviceID: deviceID,
@@ -466,71 +535,62 @@ func DeleteDeviceResources(namespace, deviceID string) (*SyncResult, error) {
 	}, nil
 }
 
-// getAllDevices fetches all devices from the server API
-func getAllDevices(serverURL string) ([]models.DeviceStatus, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	url := fmt.Sprintf("%s/devices", serverURL)
-	resp, err := client.Get(url)
+// getAllDevices returns all registered devices from the device source
+func getAllDevices() ([]models.DeviceStatus, error) {
+	source, err := getDeviceSource()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
-	}
+	return source.ListDevices()
+}
 
-	var listResponse models.DevicesListResponse
-	if err := json.NewDecoder(resp.Body).Decode(&listResponse); err != nil {
+// getDeviceByID returns a specific device from the device source
+func getDeviceByID(deviceID string) (*models.DeviceStatus, error) {
+	source, err := getDeviceSource()
+	if err != nil {
 		return nil, err
 	}
 
-	return listResponse.Devices, nil
-}
-
-// getDeviceByID fetches a specific device from the server API
-func getDeviceByID(serverURL, deviceID string) (*models.DeviceStatus, error) {
-	devices, err := getAllDevices(serverURL)
+	device, err := source.GetDevice(deviceID)
 	if err != nil {
 		return nil, err
 	}
-
-	for _, device := range devices {
-		if device.DeviceID == deviceID {
-			return &device, nil
-		}
+	if device == nil {
+		return nil, fmt.Errorf("device not found: %s", deviceID)
 	}
 
-	return nil, fmt.Errorf("device not found: %s", deviceID)
+	return device, nil
 }
 
 // CleanupAllResources removes all edge-device-* resources from a namespace
-func CleanupAllResources(namespace string) ([]string, []string, error) {
+func CleanupAllResources(namespace string) ([]string, []string, []string, error) {
 	if !IsInitialized() {
-		return nil, nil, fmt.Errorf("kubernetes client not initialized")
+		return nil, nil, nil, fmt.Errorf("kubernetes client not initialized")
 	}
 
 	// List all edge services
 	services, err := ListEdgeServices(namespace)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list services: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to list services: %w", err)
 	}
 
 	// List all edge endpoints
 	endpoints, err := ListEdgeEndpoints(namespace)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list endpoints: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to list endpoints: %w", err)
+	}
+
+	// List all edge endpoint slices
+	slices, err := ListEdgeEndpointSlices(namespace)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to list endpoint slices: %w", err)
 	}
 
 	// Delete all services
 	for _, serviceName := range services {
 		deviceID := serviceName[len("edge-device-"):]
 		if err := DeleteService(namespace, deviceID); err != nil {
-			return nil, nil, fmt.Errorf("failed to delete service %s: %w", serviceName, err)
+			return nil, nil, nil, fmt.Errorf("failed to delete service %s: %w", serviceName, err)
 		}
 	}
 
@@ -538,9 +598,17 @@ func CleanupAllResources(namespace string) ([]string, []string, error) {
 	for _, endpointName := range endpoints {
 		deviceID := endpointName[len("edge-device-"):]
 		if err := DeleteEndpoints(namespace, deviceID); err != nil {
-			return nil, nil, fmt.Errorf("failed to delete endpoints %s: %w", endpointName, err)
+			return nil, nil, nil, fmt.Errorf("failed to delete endpoints %s: %w", endpointName, err)
+		}
+	}
+
+	// Delete all endpoint slices
+	for _, sliceName := range slices {
+		deviceID := sliceName[len("edge-device-"):]
+		if err := DeleteEndpointSlice(namespace, deviceID); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to delete endpoint slice %s: %w", sliceName, err)
 		}
 	}
 
-	return services, endpoints, nil
+	return services, endpoints, slices, nil
 }
@@ -0,0 +1,69 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	"edge-metrics-server/models"
+)
+
+// Unhealthy device modes (KUBERNETES_UNHEALTHY_MODE)
+const (
+	UnhealthyModeDelete   = "delete"   // remove the Service/Endpoints as soon as a device is not healthy
+	UnhealthyModeNotReady = "notready" // keep them with a not-ready address until the grace period expires
+)
+
+var (
+	unhealthyMode     = UnhealthyModeDelete
+	deleteGracePeriod = 10 * time.Minute
+)
+
+// SetUnhealthyMode sets how resources of unhealthy devices are handled
+// In notready mode they are deleted once the device was last seen more than
+// gracePeriod ago
+func SetUnhealthyMode(mode string, gracePeriod time.Duration) error {
+	switch mode {
+	case UnhealthyModeDelete, UnhealthyModeNotReady:
+	default:
+		return fmt.Errorf("invalid unhealthy mode %q (expected delete or notready)", mode)
+	}
+	if gracePeriod < 0 {
+		return fmt.Errorf("invalid delete grace period %s", gracePeriod)
+	}
+
+	unhealthyMode = mode
+	deleteGracePeriod = gracePeriod
+	return nil
+}
+
+// GetUnhealthyMode returns the configured unhealthy device mode
+func GetUnhealthyMode() string {
+	return unhealthyMode
+}
+
+// GetDeleteGracePeriod returns how long unhealthy devices are kept in notready mode
+func GetDeleteGracePeriod() time.Duration {
+	return deleteGracePeriod
+}
+
+// deviceExposure decides whether a device should have Kubernetes resources and
+// whether its address is ready. Healthy devices are always exposed and ready.
+// In notready mode an unhealthy device stays exposed (not ready) until it was
+// last seen more than the grace period ago. The IP address is not checked here.
+func deviceExposure(device models.DeviceStatus, now time.Time) (expose bool, ready bool) {
+	if !device.IsApproved() {
+		return false, false
+	}
+	if device.Status == "healthy" {
+		return true, true
+	}
+	if unhealthyMode != UnhealthyModeNotReady || device.LastSeen == "" {
+		return false, false
+	}
+
+	lastSeen, err := time.Parse(time.RFC3339, device.LastSeen)
+	if err != nil || now.Sub(lastSeen) > deleteGracePeriod {
+		return false, false
+	}
+	return true, false
+}
@@ -1,11 +1,23 @@
 package main
 
 import (
+	"edge-metrics-server/auth"
+	"edge-metrics-server/catalog"
 	"edge-metrics-server/database"
+	"edge-metrics-server/discovery"
+	"edge-metrics-server/exporter"
+	"edge-metrics-server/fanout"
+	"edge-metrics-server/handlers"
+	"edge-metrics-server/health"
 	"edge-metrics-server/kubernetes"
+	"edge-metrics-server/repository"
 	"edge-metrics-server/router"
+	"edge-metrics-server/secrets"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,12 +34,259 @@ func main() {
 		dbPath = "./config.db"
 	}
 
+	catalogPath := os.Getenv("METRIC_CATALOG_PATH")
+	if catalogPath == "" {
+		catalogPath = "./edge-metric-list.json"
+	}
+
+	healthInterval := 30 * time.Second
+	if v := os.Getenv("HEALTH_CHECK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid HEALTH_CHECK_INTERVAL: %q", v)
+		}
+		healthInterval = d
+	}
+
+	// A poll round may take up to the interval by default
+	healthPollDeadline := healthInterval
+	if v := os.Getenv("HEALTH_POLL_DEADLINE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid HEALTH_POLL_DEADLINE: %q", v)
+		}
+		healthPollDeadline = d
+	}
+
+	fanoutConcurrency := 20
+	if v := os.Getenv("FANOUT_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid FANOUT_CONCURRENCY: %q", v)
+		}
+		fanoutConcurrency = n
+	}
+
+	fanoutDeadline := 30 * time.Second
+	if v := os.Getenv("FANOUT_DEADLINE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid FANOUT_DEADLINE: %q", v)
+		}
+		fanoutDeadline = d
+	}
+	fanout.Configure(fanoutConcurrency, fanoutDeadline)
+
+	reloadMaxAttempts := 20
+	if v := os.Getenv("RELOAD_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid RELOAD_MAX_ATTEMPTS: %q", v)
+		}
+		reloadMaxAttempts = n
+	}
+
+	reloadRetryBase := 5 * time.Second
+	if v := os.Getenv("RELOAD_RETRY_BASE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid RELOAD_RETRY_BASE: %q", v)
+		}
+		reloadRetryBase = d
+	}
+
+	reloadRetryMax := 10 * time.Minute
+	if v := os.Getenv("RELOAD_RETRY_MAX"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid RELOAD_RETRY_MAX: %q", v)
+		}
+		reloadRetryMax = d
+	}
+	exporter.Configure(reloadMaxAttempts, reloadRetryBase, reloadRetryMax)
+
+	controllerEnabled := os.Getenv("KUBERNETES_CONTROLLER_ENABLED") == "true"
+
+	reconcileInterval := time.Minute
+	if v := os.Getenv("KUBERNETES_RECONCILE_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid KUBERNETES_RECONCILE_INTERVAL: %q", v)
+		}
+		reconcileInterval = d
+	}
+
+	if v := os.Getenv("KUBERNETES_ENDPOINTS_MODE"); v != "" {
+		if err := kubernetes.SetEndpointsMode(v); err != nil {
+			log.Fatalf("Invalid KUBERNETES_ENDPOINTS_MODE: %q", v)
+		}
+	}
+
+	unhealthyMode := kubernetes.UnhealthyModeDelete
+	if v := os.Getenv("KUBERNETES_UNHEALTHY_MODE"); v != "" {
+		unhealthyMode = v
+	}
+	deleteGracePeriod := 10 * time.Minute
+	if v := os.Getenv("KUBERNETES_DELETE_GRACE_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid KUBERNETES_DELETE_GRACE_PERIOD: %q", v)
+		}
+		deleteGracePeriod = d
+	}
+	if err := kubernetes.SetUnhealthyMode(unhealthyMode, deleteGracePeriod); err != nil {
+		log.Fatalf("Invalid KUBERNETES_UNHEALTHY_MODE: %q", unhealthyMode)
+	}
+
+	if v := os.Getenv("PROMETHEUS_MONITOR_KIND"); v != "" {
+		if err := kubernetes.SetMonitorKind(v); err != nil {
+			log.Fatalf("Invalid PROMETHEUS_MONITOR_KIND: %q", v)
+		}
+	}
+	if v, ok := os.LookupEnv("PROMETHEUS_MONITOR_LABELS"); ok {
+		monitorLabels := make(map[string]string)
+		for _, pair := range strings.Split(v, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			key, value, found := strings.Cut(pair, "=")
+			if !found || strings.TrimSpace(key) == "" {
+				log.Fatalf("Invalid PROMETHEUS_MONITOR_LABELS: %q", v)
+			}
+			monitorLabels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		kubernetes.SetMonitorLabels(monitorLabels)
+	}
+
+	fileSDDir := os.Getenv("FILE_SD_DIR")
+	fileSDFormat := discovery.FileFormatJSON
+	if v := os.Getenv("FILE_SD_FORMAT"); v != "" {
+		if v != discovery.FileFormatJSON && v != discovery.FileFormatYAML {
+			log.Fatalf("Invalid FILE_SD_FORMAT: %q", v)
+		}
+		fileSDFormat = v
+	}
+
+	// X-Forwarded-For is only used for the client IP (the observed IP of enrolling
+	// devices and heartbeats) when the request comes from a trusted proxy
+	trustedProxiesEnv := os.Getenv("TRUSTED_PROXIES")
+	var trustedProxies []string
+	for _, proxy := range strings.Split(trustedProxiesEnv, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+
+	authEnabled := false
+	if v := os.Getenv("AUTH_ENABLED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid AUTH_ENABLED: %q", v)
+		}
+		authEnabled = b
+	}
+	if authEnabled {
+		authenticators := []auth.Authenticator{auth.TokenAuthenticator{}}
+		if os.Getenv("OIDC_ISSUER_URL") != "" || os.Getenv("OIDC_JWKS_URL") != "" {
+			jwtAuth, err := auth.NewJWTAuthenticator(auth.JWTConfig{
+				IssuerURL:     os.Getenv("OIDC_ISSUER_URL"),
+				Audience:      os.Getenv("OIDC_AUDIENCE"),
+				JWKSURL:       os.Getenv("OIDC_JWKS_URL"),
+				RoleClaim:     os.Getenv("OIDC_ROLE_CLAIM"),
+				UsernameClaim: os.Getenv("OIDC_USERNAME_CLAIM"),
+			})
+			if err != nil {
+				log.Fatalf("Invalid OIDC configuration: %v", err)
+			}
+			authenticators = append(authenticators, jwtAuth)
+		}
+		auth.Enable(authenticators...)
+	}
+
+	if v := os.Getenv("DEVICE_AUTH_REQUIRED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid DEVICE_AUTH_REQUIRED: %q", v)
+		}
+		auth.SetDeviceAuthRequired(b)
+	}
+	if !auth.DeviceAuthRequired() {
+		log.Printf("WARNING: Device authentication not required (DEVICE_AUTH_REQUIRED=false), exporters may read configs without their device token")
+	}
+
+	// Key for secret extra config fields, given directly or as a mounted file
+	encryptionKey := os.Getenv("CONFIG_ENCRYPTION_KEY")
+	if path := os.Getenv("CONFIG_ENCRYPTION_KEY_FILE"); path != "" {
+		if encryptionKey != "" {
+			log.Fatalf("Only one of CONFIG_ENCRYPTION_KEY and CONFIG_ENCRYPTION_KEY_FILE can be set")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read CONFIG_ENCRYPTION_KEY_FILE: %v", err)
+		}
+		encryptionKey = string(data)
+	}
+	if encryptionKey != "" {
+		key, err := secrets.ParseKey(encryptionKey)
+		if err != nil {
+			log.Fatalf("Invalid config encryption key: %v", err)
+		}
+		if err := secrets.Configure(key); err != nil {
+			log.Fatalf("Invalid config encryption key: %v", err)
+		}
+	}
+
 	// Initialize database
 	if err := database.InitDB(dbPath); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer database.CloseDB()
 
+	// Create an admin API token on first start, shown only once
+	if authEnabled {
+		if token, err := auth.Bootstrap(); err != nil {
+			log.Fatalf("Failed to create bootstrap API token: %v", err)
+		} else if token != "" {
+			log.Printf("Created bootstrap admin API token (shown only once): %s", token)
+		}
+		log.Printf("API authentication enabled")
+	}
+
+	// Load secret extra config paths
+	if err := handlers.LoadSecretPaths(); err != nil {
+		log.Fatalf("Failed to load secret paths: %v", err)
+	}
+	if paths := secrets.Paths(); len(paths) > 0 && !secrets.Enabled() {
+		log.Printf("WARNING: %d secret paths configured but no config encryption key set (secret values cannot be decrypted or stored)", len(paths))
+	} else if secrets.Enabled() {
+		log.Printf("Config encryption enabled: %d secret paths", len(paths))
+	}
+
+	// Device signing keys are encrypted with the same key
+	if sealed, err := repository.SealSigningKeys(); err != nil {
+		log.Fatalf("Failed to encrypt device signing keys: %v", err)
+	} else if sealed > 0 {
+		log.Printf("Encrypted %d device signing keys", sealed)
+	}
+
+	// Load metric catalog (optional, enabled_metrics validation is skipped without it)
+	if err := catalog.Load(catalogPath); err != nil {
+		log.Printf("Metric catalog not loaded: %v (enabled_metrics validation disabled)", err)
+	} else {
+		log.Printf("Metric catalog loaded: %d device types", len(catalog.DeviceTypes()))
+
+		// Seed per-device_type templates from the catalog defaults (once per device type)
+		if created, err := handlers.SeedTemplatesFromCatalog(); err != nil {
+			log.Printf("Device templates not seeded: %v", err)
+		} else if created > 0 {
+			log.Printf("Seeded %d device templates from the metric catalog", created)
+		}
+	}
+
+	// Kubernetes sync reads devices from the repository and health cache
+	kubernetes.SetDeviceSource(health.NewDeviceSource())
+	kubernetes.SetScrapeSettingsSource(repository.GetAllScrapeSettings)
+
 	// Initialize Kubernetes client (optional, will fail gracefully if not in k8s)
 	if err := kubernetes.InitClient(); err != nil {
 		log.Printf("Kubernetes client not initialized: %v (Kubernetes features disabled)", err)
@@ -35,9 +294,43 @@ func main() {
 		log.Printf("Kubernetes client initialized successfully")
 	}
 
+	// Start Kubernetes reconciliation controller (optional)
+	if controllerEnabled && kubernetes.IsInitialized() {
+		if err := kubernetes.StartController(kubernetes.GetNamespace(), reconcileInterval); err != nil {
+			log.Printf("Kubernetes controller not started: %v", err)
+		}
+	}
+
+	// Health status changes update the Kubernetes resources and the file SD targets
+	health.OnStatusChange(func(deviceID, oldStatus, newStatus string) {
+		kubernetes.RequestReconcile(deviceID)
+		discovery.Notify()
+	})
+
+	// Start file-based service discovery export (optional)
+	if fileSDDir != "" {
+		if err := discovery.StartFileSD(fileSDDir, fileSDFormat); err != nil {
+			log.Printf("File SD not started: %v", err)
+		}
+	}
+
+	// Start background health poller
+	health.StartPoller(healthInterval, healthPollDeadline)
+	log.Printf("Health poller started (interval: %s, deadline: %s)", healthInterval, healthPollDeadline)
+
+	// Acknowledged reloads are followed by a drift check of the running config
+	exporter.OnReloaded(handlers.CheckDeviceSync)
+
+	// Start reload outbox worker (retries undelivered reloads with backoff)
+	exporter.StartOutbox()
+	log.Printf("Reload outbox started (max attempts: %d, backoff: %s-%s)", reloadMaxAttempts, reloadRetryBase, reloadRetryMax)
+
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %q", trustedProxiesEnv)
+	}
 
 	// Setup routes
 	router.SetupRoutes(r)
@@ -1,5 +1,12 @@
 package models
 
+// Device approval states
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
 // DeviceConfig represents the configuration for a device
 type DeviceConfig struct {
 	DeviceID       string                 `json:"-"`
@@ -9,18 +16,63 @@ type DeviceConfig struct {
 	EnabledMetrics []string               `json:"enabled_metrics,omitempty"`
 	ExtraConfig    map[string]interface{} `json:"-"` // Device-specific config (shelly, jetson, ina260, etc.)
 	IPAddress      string                 `json:"ip_address"`
+	ApprovalStatus string                 `json:"-"` // pending, approved, rejected (managed by enrollment)
+	Labels         map[string]string      `json:"-"` // Key/value labels for label selectors (nil keeps existing labels on update)
+	Profiles       []string               `json:"-"` // Profile names, later profiles win (nil keeps existing profiles on update)
+	Version        int                    `json:"-"` // Incremented on every change, exposed as the ETag of GET /config/:device_id
 }
 
-// DeviceStatus represents a device with its health status
-type DeviceStatus struct {
-	DeviceID   string `json:"device_id"`
-	DeviceType string `json:"device_type"`
-	IPAddress  string `json:"ip_address,omitempty"`
+// IsApproved reports whether a device may be exposed to Prometheus
+// (an empty status comes from servers without enrollment support)
+func (c *DeviceConfig) IsApproved() bool {
+	return isApproved(c.ApprovalStatus)
+}
+
+// EnrollRequest represents the request body sent by an exporter on boot
+type EnrollRequest struct {
+	DeviceID   string `json:"device_id" binding:"required"`
+	DeviceType string `json:"device_type" binding:"required"`
 	Port       int    `json:"port"`
 	ReloadPort int    `json:"reload_port"`
-	Status     string `json:"status"` // healthy, unhealthy, unreachable
-	LastSeen   string `json:"last_seen,omitempty"`
-	Error      string `json:"error,omitempty"`
+	IPAddress  string `json:"ip_address"`
+	Token      string `json:"token"`
+}
+
+// DeviceStatus represents a device with its health status
+type DeviceStatus struct {
+	DeviceID            string            `json:"device_id"`
+	DeviceType          string            `json:"device_type"`
+	IPAddress           string            `json:"ip_address,omitempty"`
+	Port                int               `json:"port"`
+	ReloadPort          int               `json:"reload_port"`
+	ApprovalStatus      string            `json:"approval_status"` // pending, approved, rejected
+	Labels              map[string]string `json:"labels"`
+	Status              string            `json:"status"` // healthy, unhealthy, unreachable, unknown
+	LastSeen            string            `json:"last_seen,omitempty"`
+	LastChecked         string            `json:"last_checked,omitempty"`
+	ConsecutiveFailures int               `json:"consecutive_failures"`
+	LatencyMs           int64             `json:"latency_ms,omitempty"`
+	Error               string            `json:"error,omitempty"`
+}
+
+// IsApproved reports whether a device may be exposed to Prometheus
+func (s *DeviceStatus) IsApproved() bool {
+	return isApproved(s.ApprovalStatus)
+}
+
+func isApproved(approvalStatus string) bool {
+	return approvalStatus == "" || approvalStatus == ApprovalApproved
+}
+
+// DeviceHealth represents the cached result of the latest health checks for a device
+type DeviceHealth struct {
+	DeviceID            string `json:"device_id"`
+	Status              string `json:"status"`
+	LastSeen            string `json:"last_seen,omitempty"`
+	LastChecked         string `json:"last_checked,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LatencyMs           int64  `json:"latency_ms,omitempty"`
 }
 
 // DevicesListResponse represents the response for listing all devices
@@ -31,17 +83,186 @@ type DevicesListResponse struct {
 	Unhealthy int            `json:"unhealthy"`
 }
 
+// ConfigRevision represents a saved revision of a device configuration
+type ConfigRevision struct {
+	DeviceID  string       `json:"device_id"`
+	Revision  int          `json:"revision"`
+	Source    string       `json:"source"` // create, update, patch, patch_device, bulk_patch, rollback, enroll, ip_change
+	CreatedAt string       `json:"created_at"`
+	Config    DeviceConfig `json:"-"`
+}
+
+// DeviceEvent represents an entry in the device event log
+type DeviceEvent struct {
+	ID        int64  `json:"id"`
+	DeviceID  string `json:"device_id"`
+	Type      string `json:"type"` // ip_changed, endpoints_updated, endpoints_update_failed
+	OldValue  string `json:"old_value,omitempty"`
+	NewValue  string `json:"new_value,omitempty"`
+	Source    string `json:"source,omitempty"` // heartbeat, enroll, patch_device
+	Message   string `json:"message,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ScrapeSettings represents the Prometheus scrape settings of a device type
+// Used to generate ServiceMonitor / ScrapeConfig objects
+type ScrapeSettings struct {
+	DeviceType    string          `json:"device_type"`
+	Interval      string          `json:"interval"`                 // Prometheus duration, e.g. 15s
+	ScrapeTimeout string          `json:"scrape_timeout,omitempty"` // must not exceed interval
+	MetricsPath   string          `json:"metrics_path"`
+	Relabelings   []RelabelConfig `json:"relabelings"`
+	CreatedAt     string          `json:"created_at,omitempty"`
+	UpdatedAt     string          `json:"updated_at,omitempty"`
+}
+
+// RelabelConfig represents a Prometheus relabeling rule
+type RelabelConfig struct {
+	SourceLabels []string `json:"source_labels,omitempty"`
+	Separator    string   `json:"separator,omitempty"`
+	TargetLabel  string   `json:"target_label,omitempty"`
+	Regex        string   `json:"regex,omitempty"`
+	Replacement  string   `json:"replacement,omitempty"`
+	Action       string   `json:"action,omitempty"` // replace (default), keep, drop, labelmap, labeldrop, labelkeep, hashmod, lowercase, uppercase
+}
+
+// Profile represents a named partial device configuration shared by devices
+// Config holds enabled_metrics and extra config blocks in the GET /config/:device_id format
+type Profile struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Config      map[string]interface{} `json:"config"`
+	CreatedAt   string                 `json:"created_at,omitempty"`
+	UpdatedAt   string                 `json:"updated_at,omitempty"`
+}
+
+// DeviceTemplate represents the defaults applied to new devices of a device type
+// (and to fields reset to null by PATCH /config/:device_id)
+type DeviceTemplate struct {
+	DeviceType     string                 `json:"device_type"`
+	Port           int                    `json:"port,omitempty"`        // 0 = server default (9100)
+	ReloadPort     int                    `json:"reload_port,omitempty"` // 0 = server default (9101)
+	EnabledMetrics []string               `json:"enabled_metrics"`
+	ExtraConfig    map[string]interface{} `json:"extra_config"`
+	CreatedAt      string                 `json:"created_at,omitempty"`
+	UpdatedAt      string                 `json:"updated_at,omitempty"`
+}
+
+// ConfigSchema represents a JSON Schema for an extra config block (e.g. shelly) of a device type
+type ConfigSchema struct {
+	DeviceType string                 `json:"device_type"`
+	Block      string                 `json:"block"`
+	Schema     map[string]interface{} `json:"schema"`
+	CreatedAt  string                 `json:"created_at,omitempty"`
+	UpdatedAt  string                 `json:"updated_at,omitempty"`
+}
+
+// Reload job states
+const (
+	ReloadPending   = "pending"   // Waiting for its (next) delivery attempt
+	ReloadDelivered = "delivered" // The device acknowledged the reload
+	ReloadFailed    = "failed"    // Gave up after the maximum number of attempts
+	ReloadCancelled = "cancelled" // The device was deleted
+)
+
+// ReloadJob represents a queued reload of a device (reload outbox entry)
+// A device has at most one pending job; further changes are coalesced into it
+type ReloadJob struct {
+	ID            int64  `json:"id"`
+	DeviceID      string `json:"device_id"`
+	Version       int    `json:"version"` // Config version the reload was requested for
+	Reason        string `json:"reason"`  // update, patch, rollback, bulk_patch, profile
+	Status        string `json:"status"`  // pending, delivered, failed, cancelled
+	Attempts      int    `json:"attempts"`
+	Coalesced     int    `json:"coalesced"` // Requests merged into this job after it was queued
+	LastError     string `json:"last_error,omitempty"`
+	NextAttemptAt string `json:"next_attempt_at,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+	DeliveredAt   string `json:"delivered_at,omitempty"`
+}
+
+// Config sync states of a device
+const (
+	SyncInSync  = "in_sync" // The device runs the stored config
+	SyncDrifted = "drifted" // The running config differs from the stored config
+	SyncPending = "pending" // The stored config changed since the last check
+	SyncUnknown = "unknown" // Never checked, or the running config could not be fetched
+)
+
+// DeviceSyncState represents the result of the latest comparison of a device's
+// running config (GET /config on the exporter) with its stored effective config
+type DeviceSyncState struct {
+	DeviceID        string         `json:"device_id"`
+	Status          string         `json:"status"`                     // in_sync, drifted, pending, unknown
+	ConfigVersion   int            `json:"config_version"`             // Config version the device was compared against
+	AppliedRevision int            `json:"applied_revision,omitempty"` // Last revision the device was confirmed running
+	Diff            []ConfigChange `json:"diff,omitempty"`             // old: stored value, new: running value
+	Error           string         `json:"error,omitempty"`
+	CheckedAt       string         `json:"checked_at,omitempty"`
+	SyncedAt        string         `json:"synced_at,omitempty"` // Last time the device was in sync
+}
+
+// APIToken represents a static API token (the token itself is only stored as a SHA-256 hash)
+type APIToken struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`   // viewer, operator, admin
+	Prefix     string `json:"prefix"` // First characters of the token, to tell tokens apart
+	TokenHash  string `json:"-"`
+	CreatedAt  string `json:"created_at"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
+
+// DeviceCredential represents the secret token of a device. The exporter sends it
+// when fetching its config; only its SHA-256 hash is stored. Requests the server
+// sends to the exporter are signed with a key derived from the token, which is
+// stored instead of the token.
+type DeviceCredential struct {
+	DeviceID   string `json:"device_id"`
+	Prefix     string `json:"prefix"` // First characters of the token
+	Token      string `json:"-"`      // Only set when issued
+	TokenHash  string `json:"-"`
+	SigningKey string `json:"-"`
+	CreatedAt  string `json:"created_at"` // Issue or last rotation time
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
+
+// SecretPath marks a dotted extra config path (e.g. shelly.password) as secret
+// Values at secret paths are encrypted at rest and redacted in API responses.
+type SecretPath struct {
+	Path      string `json:"path"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ConfigChange represents a single field-level difference between two configs
+type ConfigChange struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"` // added, removed, changed
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error    string `json:"error"`
-	DeviceID string `json:"device_id,omitempty"`
-	Message  string `json:"message,omitempty"`
+	Error    string       `json:"error"`
+	DeviceID string       `json:"device_id,omitempty"`
+	Message  string       `json:"message,omitempty"`
+	Details  []FieldError `json:"details,omitempty"` // Field-level validation errors
+}
+
+// FieldError represents a validation error of a single field
+type FieldError struct {
+	Path    string `json:"path"` // Dotted path, e.g. shelly.channels[0].name
+	Message string `json:"message"`
 }
 
 // UpdateResponse represents a successful update response
 type UpdateResponse struct {
-	Status   string `json:"status"`
-	DeviceID string `json:"device_id"`
+	Status      string `json:"status"`
+	DeviceID    string `json:"device_id"`
+	DeviceToken string `json:"device_token,omitempty"` // Only when a device credential was issued
 }
 
 // HealthResponse represents a health check response
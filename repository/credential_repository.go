@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"edge-metrics-server/secrets"
+	"log"
+	"time"
+)
+
+// SaveDeviceCredential stores the credential of a device, replacing the previous one
+// The signing key is encrypted if a config encryption key is configured.
+// credential.CreatedAt is set on success
+func SaveDeviceCredential(credential *models.DeviceCredential) error {
+	signingKey, err := secrets.SealString(credential.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	query := `
+		INSERT INTO device_credentials (device_id, token_hash, signing_key, prefix, created_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?, NULL)
+		ON CONFLICT(device_id) DO UPDATE SET
+			token_hash = excluded.token_hash,
+			signing_key = excluded.signing_key,
+			prefix = excluded.prefix,
+			created_at = excluded.created_at,
+			last_used_at = NULL
+	`
+
+	_, err = database.DB.Exec(query,
+		credential.DeviceID,
+		credential.TokenHash,
+		signingKey,
+		credential.Prefix,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+
+	credential.CreatedAt = now.Format(time.RFC3339)
+	credential.LastUsedAt = ""
+	return nil
+}
+
+// GetDeviceCredential retrieves the credential of a device
+// Returns nil if no credential was issued for the device. A signing key that
+// cannot be decrypted (no or wrong config encryption key) is left empty.
+func GetDeviceCredential(deviceID string) (*models.DeviceCredential, error) {
+	query := `
+		SELECT device_id, token_hash, signing_key, prefix, created_at, last_used_at
+		FROM device_credentials
+		WHERE device_id = ?
+	`
+
+	var credential models.DeviceCredential
+	var createdAt, lastUsedAt sql.NullTime
+	err := database.DB.QueryRow(query, deviceID).Scan(
+		&credential.DeviceID,
+		&credential.TokenHash,
+		&credential.SigningKey,
+		&credential.Prefix,
+		&createdAt,
+		&lastUsedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	signingKey, err := secrets.OpenString(credential.SigningKey)
+	if err != nil {
+		log.Printf("Signing key of %s not decrypted: %v", deviceID, err)
+	}
+	credential.SigningKey = signingKey
+
+	if createdAt.Valid {
+		credential.CreatedAt = createdAt.Time.Format(time.RFC3339)
+	}
+	if lastUsedAt.Valid {
+		credential.LastUsedAt = lastUsedAt.Time.Format(time.RFC3339)
+	}
+
+	return &credential, nil
+}
+
+// SealSigningKeys encrypts the signing keys stored before a config encryption
+// key was configured. Returns the number of keys encrypted.
+func SealSigningKeys() (int, error) {
+	if !secrets.Enabled() {
+		return 0, nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // No-op after commit
+
+	rows, err := tx.Query("SELECT device_id, signing_key FROM device_credentials")
+	if err != nil {
+		return 0, err
+	}
+
+	updates := make(map[string]string)
+	for rows.Next() {
+		var deviceID, stored string
+		if err := rows.Scan(&deviceID, &stored); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		sealed, err := secrets.SealString(stored)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if sealed != stored {
+			updates[deviceID] = sealed
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for deviceID, sealed := range updates {
+		if _, err := tx.Exec("UPDATE device_credentials SET signing_key = ? WHERE device_id = ?", sealed, deviceID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(updates), nil
+}
+
+// TouchDeviceCredential records the last time a device authenticated with its credential
+func TouchDeviceCredential(deviceID string, usedAt time.Time) error {
+	_, err := database.DB.Exec(
+		"UPDATE device_credentials SET last_used_at = ? WHERE device_id = ?",
+		usedAt.UTC(), deviceID,
+	)
+	return err
+}
+
+// DeleteDeviceCredential removes the credential of a device
+func DeleteDeviceCredential(deviceID string) error {
+	_, err := database.DB.Exec("DELETE FROM device_credentials WHERE device_id = ?", deviceID)
+	return err
+}
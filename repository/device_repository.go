@@ -4,21 +4,26 @@ import (
 	"database/sql"
 	"edge-metrics-server/database"
 	"edge-metrics-server/models"
+	"edge-metrics-server/secrets"
 	"encoding/json"
+	"errors"
 	"time"
 )
 
+// ErrVersionConflict is returned when a conditional write finds a different device version
+var ErrVersionConflict = errors.New("device config version conflict")
+
 // GetByDeviceID retrieves a device configuration by device ID
 func GetByDeviceID(deviceID string) (*models.DeviceConfig, error) {
 	query := `
 		SELECT device_id, device_type, port, reload_port,
-		       enabled_metrics, extra_config, ip_address
+		       enabled_metrics, extra_config, ip_address, approval_status, version
 		FROM devices
 		WHERE device_id = ?
 	`
 
 	var config models.DeviceConfig
-	var enabledMetrics, extraConfig, ipAddress sql.NullString
+	var enabledMetrics, extraConfig, ipAddress, approvalStatus sql.NullString
 
 	err := database.DB.QueryRow(query, deviceID).Scan(
 		&config.DeviceID,
@@ -28,11 +33,14 @@ func GetByDeviceID(deviceID string) (*models.DeviceConfig, error) {
 		&enabledMetrics,
 		&extraConfig,
 		&ipAddress,
+		&approvalStatus,
+		&config.Version,
 	)
 
 	if ipAddress.Valid {
 		config.IPAddress = ipAddress.String
 	}
+	config.ApprovalStatus = approvalStatusOrDefault(approvalStatus)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -53,6 +61,17 @@ func GetByDeviceID(deviceID string) (*models.DeviceConfig, error) {
 		if err := json.Unmarshal([]byte(extraConfig.String), &config.ExtraConfig); err != nil {
 			return nil, err
 		}
+		secrets.Open(config.ExtraConfig)
+	}
+
+	config.Labels, err = GetLabels(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Profiles, err = GetDeviceProfiles(deviceID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &config, nil
@@ -60,42 +79,37 @@ func GetByDeviceID(deviceID string) (*models.DeviceConfig, error) {
 
 // Update updates an existing device configuration
 func Update(deviceID string, config *models.DeviceConfig) error {
-	// Check if device exists
-	existing, err := GetByDeviceID(deviceID)
-	if err != nil {
-		return err
-	}
-	if existing == nil {
-		return sql.ErrNoRows // Device not found
-	}
+	return UpdateIfVersion(deviceID, config, 0)
+}
 
+// UpdateIfVersion updates an existing device configuration if its version still matches
+// version 0 updates unconditionally. Returns ErrVersionConflict on a mismatch.
+// config.Version is set to the new version.
+func UpdateIfVersion(deviceID string, config *models.DeviceConfig, version int) error {
 	// Convert slices and maps to JSON
-	var enabledMetrics, extraConfig sql.NullString
-
-	if len(config.EnabledMetrics) > 0 {
-		data, err := json.Marshal(config.EnabledMetrics)
-		if err != nil {
-			return err
-		}
-		enabledMetrics = sql.NullString{String: string(data), Valid: true}
+	enabledMetrics, extraConfig, err := encodeConfigFields(config)
+	if err != nil {
+		return err
 	}
 
-	if len(config.ExtraConfig) > 0 {
-		data, err := json.Marshal(config.ExtraConfig)
-		if err != nil {
-			return err
-		}
-		extraConfig = sql.NullString{String: string(data), Valid: true}
+	// The row, labels and profiles change together so readers never see a new
+	// version with the old labels or profiles
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback() // No-op after commit
 
 	query := `
 		UPDATE devices
 		SET device_type = ?, port = ?, reload_port = ?,
-		    enabled_metrics = ?, extra_config = ?, ip_address = ?, updated_at = ?
-		WHERE device_id = ?
+		    enabled_metrics = ?, extra_config = ?, ip_address = ?, updated_at = ?,
+		    version = version + 1
+		WHERE device_id = ? AND (? = 0 OR version = ?)
+		RETURNING version
 	`
 
-	_, err = database.DB.Exec(query,
+	err = tx.QueryRow(query,
 		config.DeviceType,
 		config.Port,
 		config.ReloadPort,
@@ -104,39 +118,58 @@ func Update(deviceID string, config *models.DeviceConfig) error {
 		config.IPAddress,
 		time.Now(),
 		deviceID,
-	)
+		version,
+		version,
+	).Scan(&config.Version)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return missingOrConflict(deviceID)
+	}
+	if err != nil {
+		return err
+	}
 
-	return err
+	// nil labels and profiles keep the existing ones
+	if config.Labels != nil {
+		if err := replaceLabels(tx, deviceID, config.Labels); err != nil {
+			return err
+		}
+	}
+	if config.Profiles != nil {
+		if err := replaceDeviceProfiles(tx, deviceID, config.Profiles); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // Create creates a new device configuration
+// Devices are approved unless config.ApprovalStatus says otherwise. A device that
+// existed before continues from its last version (or latest revision), so clients
+// holding an old ETag do not mistake the new config for the one they have.
 func Create(config *models.DeviceConfig) error {
 	// Convert slices and maps to JSON
-	var enabledMetrics, extraConfig sql.NullString
-
-	if len(config.EnabledMetrics) > 0 {
-		data, err := json.Marshal(config.EnabledMetrics)
-		if err != nil {
-			return err
-		}
-		enabledMetrics = sql.NullString{String: string(data), Valid: true}
+	enabledMetrics, extraConfig, err := encodeConfigFields(config)
+	if err != nil {
+		return err
 	}
 
-	if len(config.ExtraConfig) > 0 {
-		data, err := json.Marshal(config.ExtraConfig)
-		if err != nil {
-			return err
-		}
-		extraConfig = sql.NullString{String: string(data), Valid: true}
+	if config.ApprovalStatus == "" {
+		config.ApprovalStatus = models.ApprovalApproved
 	}
 
 	query := `
 		INSERT INTO devices (device_id, device_type, port, reload_port,
-		                    enabled_metrics, extra_config, ip_address)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		                    enabled_metrics, extra_config, ip_address, approval_status, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, MAX(
+			COALESCE((SELECT version FROM device_tombstones WHERE device_id = ?), 0),
+			COALESCE((SELECT MAX(revision) FROM config_revisions WHERE device_id = ?), 0)
+		) + 1)
+		RETURNING version
 	`
 
-	_, err := database.DB.Exec(query,
+	err = database.DB.QueryRow(query,
 		config.DeviceID,
 		config.DeviceType,
 		config.Port,
@@ -144,9 +177,46 @@ func Create(config *models.DeviceConfig) error {
 		enabledMetrics,
 		extraConfig,
 		config.IPAddress,
+		config.ApprovalStatus,
+		config.DeviceID,
+		config.DeviceID,
+	).Scan(&config.Version)
+	if err != nil {
+		return err
+	}
+
+	if len(config.Labels) > 0 {
+		if err := SetLabels(config.DeviceID, config.Labels); err != nil {
+			return err
+		}
+	}
+	if len(config.Profiles) > 0 {
+		return SetDeviceProfiles(config.DeviceID, config.Profiles)
+	}
+	return nil
+}
+
+// SetApprovalStatus updates the approval status of a device
+// The version is incremented since approval changes what is exposed for the device
+func SetApprovalStatus(deviceID, status string) error {
+	result, err := database.DB.Exec(
+		"UPDATE devices SET approval_status = ?, updated_at = ?, version = version + 1 WHERE device_id = ?",
+		status, time.Now(), deviceID,
 	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows // Device not found
+	}
 
-	return err
+	return nil
 }
 
 // Exists checks if a device exists
@@ -178,28 +248,54 @@ func Upsert(deviceID string, config *models.DeviceConfig) (bool, error) {
 
 // Delete deletes a device configuration
 func Delete(deviceID string) error {
-	result, err := database.DB.Exec("DELETE FROM devices WHERE device_id = ?", deviceID)
+	return DeleteIfVersion(deviceID, 0)
+}
+
+// DeleteIfVersion deletes a device configuration if its version still matches
+// version 0 deletes unconditionally. Returns ErrVersionConflict on a mismatch.
+// The last version is kept for a later Create of the same device.
+func DeleteIfVersion(deviceID string, version int) error {
+	tx, err := database.DB.Begin()
 	if err != nil {
 		return err
 	}
-
-	rowsAffected, err := result.RowsAffected()
+	defer tx.Rollback() // No-op after commit
+
+	var deleted int
+	err = tx.QueryRow(
+		"DELETE FROM devices WHERE device_id = ? AND (? = 0 OR version = ?) RETURNING version",
+		deviceID, version, version,
+	).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return missingOrConflict(deviceID)
+	}
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows // Device not found
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO device_tombstones (device_id, version, deleted_at) VALUES (?, ?, ?)",
+		deviceID, deleted, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
-	return nil
+	if err := DeleteLabels(deviceID); err != nil {
+		return err
+	}
+	return DeleteDeviceProfiles(deviceID)
 }
 
 // GetAll retrieves all device configurations
 func GetAll() ([]models.DeviceConfig, error) {
 	query := `
 		SELECT device_id, device_type, port, reload_port,
-		       enabled_metrics, extra_config, ip_address
+		       enabled_metrics, extra_config, ip_address, approval_status, version
 		FROM devices
 		ORDER BY device_id
 	`
@@ -210,10 +306,20 @@ func GetAll() ([]models.DeviceConfig, error) {
 	}
 	defer rows.Close()
 
+	labelsByDevice, err := GetAllLabels()
+	if err != nil {
+		return nil, err
+	}
+
+	profilesByDevice, err := GetAllDeviceProfiles()
+	if err != nil {
+		return nil, err
+	}
+
 	var devices []models.DeviceConfig
 	for rows.Next() {
 		var config models.DeviceConfig
-		var enabledMetrics, extraConfig, ipAddress sql.NullString
+		var enabledMetrics, extraConfig, ipAddress, approvalStatus sql.NullString
 
 		err := rows.Scan(
 			&config.DeviceID,
@@ -223,6 +329,8 @@ func GetAll() ([]models.DeviceConfig, error) {
 			&enabledMetrics,
 			&extraConfig,
 			&ipAddress,
+			&approvalStatus,
+			&config.Version,
 		)
 		if err != nil {
 			return nil, err
@@ -231,6 +339,7 @@ func GetAll() ([]models.DeviceConfig, error) {
 		if ipAddress.Valid {
 			config.IPAddress = ipAddress.String
 		}
+		config.ApprovalStatus = approvalStatusOrDefault(approvalStatus)
 
 		if enabledMetrics.Valid && enabledMetrics.String != "" {
 			json.Unmarshal([]byte(enabledMetrics.String), &config.EnabledMetrics)
@@ -239,6 +348,17 @@ func GetAll() ([]models.DeviceConfig, error) {
 		if extraConfig.Valid && extraConfig.String != "" {
 			config.ExtraConfig = make(map[string]interface{})
 			json.Unmarshal([]byte(extraConfig.String), &config.ExtraConfig)
+			secrets.Open(config.ExtraConfig)
+		}
+
+		config.Labels = labelsByDevice[config.DeviceID]
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+
+		config.Profiles = profilesByDevice[config.DeviceID]
+		if config.Profiles == nil {
+			config.Profiles = []string{}
 		}
 
 		devices = append(devices, config)
@@ -246,3 +366,64 @@ func GetAll() ([]models.DeviceConfig, error) {
 
 	return devices, rows.Err()
 }
+
+// IncrementVersions bumps the version of devices whose effective config changed
+// without a write to the devices row (e.g. an updated profile)
+func IncrementVersions(deviceIDs []string) error {
+	for _, deviceID := range deviceIDs {
+		_, err := database.DB.Exec("UPDATE devices SET version = version + 1 WHERE device_id = ?", deviceID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingOrConflict explains why a conditional write matched no row
+func missingOrConflict(deviceID string) error {
+	exists, err := Exists(deviceID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows // Device not found
+	}
+	return ErrVersionConflict
+}
+
+// encodeConfigFields converts enabled_metrics and extra_config to JSON columns
+// Values at secret paths are encrypted.
+func encodeConfigFields(config *models.DeviceConfig) (sql.NullString, sql.NullString, error) {
+	var enabledMetrics, extraConfig sql.NullString
+
+	if len(config.EnabledMetrics) > 0 {
+		data, err := json.Marshal(config.EnabledMetrics)
+		if err != nil {
+			return enabledMetrics, extraConfig, err
+		}
+		enabledMetrics = sql.NullString{String: string(data), Valid: true}
+	}
+
+	if len(config.ExtraConfig) > 0 {
+		sealed, err := secrets.Seal(config.ExtraConfig)
+		if err != nil {
+			return enabledMetrics, extraConfig, err
+		}
+		data, err := json.Marshal(sealed)
+		if err != nil {
+			return enabledMetrics, extraConfig, err
+		}
+		extraConfig = sql.NullString{String: string(data), Valid: true}
+	}
+
+	return enabledMetrics, extraConfig, nil
+}
+
+// approvalStatusOrDefault treats a missing approval status as approved
+// (devices created before enrollment existed)
+func approvalStatusOrDefault(status sql.NullString) string {
+	if !status.Valid || status.String == "" {
+		return models.ApprovalApproved
+	}
+	return status.String
+}
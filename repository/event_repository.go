@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"time"
+)
+
+// CreateEvent appends an entry to the device event log
+func CreateEvent(event *models.DeviceEvent) error {
+	query := `
+		INSERT INTO device_events (device_id, event_type, old_value, new_value, source, message, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := database.DB.Exec(query,
+		event.DeviceID,
+		event.Type,
+		event.OldValue,
+		event.NewValue,
+		event.Source,
+		event.Message,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	event.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetEvents retrieves the most recent events of a device, newest first
+func GetEvents(deviceID string, limit int) ([]models.DeviceEvent, error) {
+	query := `
+		SELECT id, device_id, event_type, old_value, new_value, source, message, created_at
+		FROM device_events
+		WHERE device_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	rows, err := database.DB.Query(query, deviceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.DeviceEvent
+	for rows.Next() {
+		var event models.DeviceEvent
+		var oldValue, newValue, source, message sql.NullString
+		var createdAt time.Time
+
+		err := rows.Scan(
+			&event.ID,
+			&event.DeviceID,
+			&event.Type,
+			&oldValue,
+			&newValue,
+			&source,
+			&message,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		event.OldValue = oldValue.String
+		event.NewValue = newValue.String
+		event.Source = source.String
+		event.Message = message.String
+		event.CreatedAt = createdAt.Format(time.RFC3339)
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"time"
+)
+
+// SaveHealthCheck stores the result of a health check for a device
+// A healthy result updates last_seen and resets the failure counter,
+// unhealthy/unreachable results increment it
+func SaveHealthCheck(deviceID, status, errMsg string, latencyMs int64, checkedAt time.Time) error {
+	var query string
+
+	switch status {
+	case "healthy":
+		query = `
+			INSERT INTO device_health (device_id, status, last_seen, last_checked, last_error, latency_ms, consecutive_failures)
+			VALUES (?, ?, ?, ?, ?, ?, 0)
+			ON CONFLICT(device_id) DO UPDATE SET
+				status = excluded.status,
+				last_seen = excluded.last_seen,
+				last_checked = excluded.last_checked,
+				last_error = excluded.last_error,
+				latency_ms = excluded.latency_ms,
+				consecutive_failures = 0
+		`
+		_, err := database.DB.Exec(query, deviceID, status, checkedAt, checkedAt, errMsg, latencyMs)
+		return err
+	case "unknown":
+		query = `
+			INSERT INTO device_health (device_id, status, last_checked, last_error, latency_ms, consecutive_failures)
+			VALUES (?, ?, ?, ?, ?, 0)
+			ON CONFLICT(device_id) DO UPDATE SET
+				status = excluded.status,
+				last_checked = excluded.last_checked,
+				last_error = excluded.last_error,
+				latency_ms = excluded.latency_ms
+		`
+	default:
+		query = `
+			INSERT INTO device_health (device_id, status, last_checked, last_error, latency_ms, consecutive_failures)
+			VALUES (?, ?, ?, ?, ?, 1)
+			ON CONFLICT(device_id) DO UPDATE SET
+				status = excluded.status,
+				last_checked = excluded.last_checked,
+				last_error = excluded.last_error,
+				latency_ms = excluded.latency_ms,
+				consecutive_failures = device_health.consecutive_failures + 1
+		`
+	}
+
+	_, err := database.DB.Exec(query, deviceID, status, checkedAt, errMsg, latencyMs)
+	return err
+}
+
+// GetHealth retrieves the cached health of a device
+func GetHealth(deviceID string) (*models.DeviceHealth, error) {
+	query := `
+		SELECT device_id, status, last_seen, last_checked, last_error, consecutive_failures, latency_ms
+		FROM device_health
+		WHERE device_id = ?
+	`
+
+	health, err := scanHealth(database.DB.QueryRow(query, deviceID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Not checked yet
+		}
+		return nil, err
+	}
+
+	return health, nil
+}
+
+// GetAllHealth retrieves the cached health of all devices, keyed by device ID
+func GetAllHealth() (map[string]models.DeviceHealth, error) {
+	query := `
+		SELECT device_id, status, last_seen, last_checked, last_error, consecutive_failures, latency_ms
+		FROM device_health
+	`
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	healthByDevice := make(map[string]models.DeviceHealth)
+	for rows.Next() {
+		health, err := scanHealth(rows)
+		if err != nil {
+			return nil, err
+		}
+		healthByDevice[health.DeviceID] = *health
+	}
+
+	return healthByDevice, rows.Err()
+}
+
+// DeleteHealth removes the cached health of a device
+func DeleteHealth(deviceID string) error {
+	_, err := database.DB.Exec("DELETE FROM device_health WHERE device_id = ?", deviceID)
+	return err
+}
+
+// scanHealth scans a device_health row
+func scanHealth(row rowScanner) (*models.DeviceHealth, error) {
+	var health models.DeviceHealth
+	var lastSeen, lastChecked sql.NullTime
+	var lastError sql.NullString
+	var latencyMs sql.NullInt64
+
+	err := row.Scan(
+		&health.DeviceID,
+		&health.Status,
+		&lastSeen,
+		&lastChecked,
+		&lastError,
+		&health.ConsecutiveFailures,
+		&latencyMs,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastSeen.Valid {
+		health.LastSeen = lastSeen.Time.Format(time.RFC3339)
+	}
+	if lastChecked.Valid {
+		health.LastChecked = lastChecked.Time.Format(time.RFC3339)
+	}
+	if lastError.Valid {
+		health.LastError = lastError.String
+	}
+	if latencyMs.Valid {
+		health.LatencyMs = latencyMs.Int64
+	}
+
+	return &health, nil
+}
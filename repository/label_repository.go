@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+)
+
+// GetLabels retrieves the labels of a device
+// Returns an empty map if the device has no labels
+func GetLabels(deviceID string) (map[string]string, error) {
+	rows, err := database.DB.Query("SELECT key, value FROM device_labels WHERE device_id = ?", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+
+	return labels, rows.Err()
+}
+
+// GetAllLabels retrieves the labels of all devices, keyed by device ID
+func GetAllLabels() (map[string]map[string]string, error) {
+	rows, err := database.DB.Query("SELECT device_id, key, value FROM device_labels")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := make(map[string]map[string]string)
+	for rows.Next() {
+		var deviceID, key, value string
+		if err := rows.Scan(&deviceID, &key, &value); err != nil {
+			return nil, err
+		}
+		if all[deviceID] == nil {
+			all[deviceID] = make(map[string]string)
+		}
+		all[deviceID][key] = value
+	}
+
+	return all, rows.Err()
+}
+
+// SetLabels replaces all labels of a device
+func SetLabels(deviceID string, labels map[string]string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No-op after commit
+
+	if err := replaceLabels(tx, deviceID, labels); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceLabels replaces all labels of a device within a transaction
+func replaceLabels(tx *sql.Tx, deviceID string, labels map[string]string) error {
+	if _, err := tx.Exec("DELETE FROM device_labels WHERE device_id = ?", deviceID); err != nil {
+		return err
+	}
+
+	for key, value := range labels {
+		_, err := tx.Exec(
+			"INSERT INTO device_labels (device_id, key, value) VALUES (?, ?, ?)",
+			deviceID, key, value,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteLabels removes all labels of a device
+func DeleteLabels(deviceID string) error {
+	_, err := database.DB.Exec("DELETE FROM device_labels WHERE device_id = ?", deviceID)
+	return err
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"edge-metrics-server/secrets"
+	"encoding/json"
+	"time"
+)
+
+// GetProfile retrieves a profile by name
+// Returns nil if the profile does not exist
+func GetProfile(name string) (*models.Profile, error) {
+	query := `
+		SELECT name, description, config, created_at, updated_at
+		FROM profiles
+		WHERE name = ?
+	`
+
+	profile, err := scanProfile(database.DB.QueryRow(query, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return profile, err
+}
+
+// GetAllProfiles retrieves all profiles
+func GetAllProfiles() ([]models.Profile, error) {
+	query := `
+		SELECT name, description, config, created_at, updated_at
+		FROM profiles
+		ORDER BY name
+	`
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []models.Profile
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *profile)
+	}
+
+	return profiles, rows.Err()
+}
+
+// SaveProfile creates or replaces a profile
+// Values at secret paths are encrypted.
+func SaveProfile(profile *models.Profile) error {
+	sealed, err := secrets.Seal(profile.Config)
+	if err != nil {
+		return err
+	}
+	config, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO profiles (name, description, config, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			description = excluded.description,
+			config = excluded.config,
+			updated_at = excluded.updated_at
+	`
+
+	now := time.Now()
+	_, err = database.DB.Exec(query,
+		profile.Name,
+		profile.Description,
+		string(config),
+		now,
+		now,
+	)
+	return err
+}
+
+// DeleteProfile deletes a profile
+func DeleteProfile(name string) error {
+	result, err := database.DB.Exec("DELETE FROM profiles WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetDeviceProfiles retrieves the profile names of a device in order
+func GetDeviceProfiles(deviceID string) ([]string, error) {
+	rows, err := database.DB.Query(
+		"SELECT profile_name FROM device_profiles WHERE device_id = ? ORDER BY position",
+		deviceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// GetAllDeviceProfiles retrieves the profile names of all devices, keyed by device ID
+func GetAllDeviceProfiles() (map[string][]string, error) {
+	rows, err := database.DB.Query(
+		"SELECT device_id, profile_name FROM device_profiles ORDER BY device_id, position",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := make(map[string][]string)
+	for rows.Next() {
+		var deviceID, name string
+		if err := rows.Scan(&deviceID, &name); err != nil {
+			return nil, err
+		}
+		all[deviceID] = append(all[deviceID], name)
+	}
+
+	return all, rows.Err()
+}
+
+// GetProfileDeviceIDs retrieves the IDs of the devices using a profile
+func GetProfileDeviceIDs(name string) ([]string, error) {
+	rows, err := database.DB.Query(
+		"SELECT device_id FROM device_profiles WHERE profile_name = ? ORDER BY device_id",
+		name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deviceIDs := []string{}
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, err
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+
+	return deviceIDs, rows.Err()
+}
+
+// SetDeviceProfiles replaces the profiles of a device
+func SetDeviceProfiles(deviceID string, names []string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No-op after commit
+
+	if err := replaceDeviceProfiles(tx, deviceID, names); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceDeviceProfiles replaces the profiles of a device within a transaction
+func replaceDeviceProfiles(tx *sql.Tx, deviceID string, names []string) error {
+	if _, err := tx.Exec("DELETE FROM device_profiles WHERE device_id = ?", deviceID); err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		_, err := tx.Exec(
+			"INSERT INTO device_profiles (device_id, profile_name, position) VALUES (?, ?, ?)",
+			deviceID, name, i,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteDeviceProfiles removes all profile assignments of a device
+func DeleteDeviceProfiles(deviceID string) error {
+	_, err := database.DB.Exec("DELETE FROM device_profiles WHERE device_id = ?", deviceID)
+	return err
+}
+
+// scanProfile scans a profiles row
+func scanProfile(row rowScanner) (*models.Profile, error) {
+	var profile models.Profile
+	var description, config sql.NullString
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(
+		&profile.Name,
+		&description,
+		&config,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.Description = description.String
+	profile.CreatedAt = createdAt.Format(time.RFC3339)
+	profile.UpdatedAt = updatedAt.Format(time.RFC3339)
+
+	profile.Config = make(map[string]interface{})
+	if config.Valid && config.String != "" {
+		if err := json.Unmarshal([]byte(config.String), &profile.Config); err != nil {
+			return nil, err
+		}
+		secrets.Open(profile.Config)
+	}
+
+	return &profile, nil
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"strings"
+	"time"
+)
+
+// reloadJobColumns are the columns read by scanReloadJob
+const reloadJobColumns = `id, device_id, version, reason, status, attempts, coalesced,
+	last_error, next_attempt_at, created_at, updated_at, delivered_at`
+
+// EnqueueReload queues a reload of a device for its current config version, due immediately
+// If the device already has a pending job the request is coalesced into it
+// (latest version and reason, attempts reset). Returns the job ID.
+func EnqueueReload(deviceID, reason string) (int64, error) {
+	query := `
+		INSERT INTO reload_jobs (device_id, version, reason, status, next_attempt_at, created_at, updated_at)
+		VALUES (?, (SELECT version FROM devices WHERE device_id = ?), ?, ?, ?, ?, ?)
+		ON CONFLICT(device_id) WHERE status = 'pending' DO UPDATE SET
+			version = excluded.version,
+			reason = excluded.reason,
+			attempts = 0,
+			coalesced = coalesced + 1,
+			next_attempt_at = excluded.next_attempt_at,
+			updated_at = excluded.updated_at
+		RETURNING id
+	`
+
+	now := time.Now().UTC()
+	var id int64
+	err := database.DB.QueryRow(query,
+		deviceID,
+		deviceID,
+		reason,
+		models.ReloadPending,
+		now,
+		now,
+		now,
+	).Scan(&id)
+	return id, err
+}
+
+// DueReloadJobs returns the IDs of pending jobs whose next attempt is due, oldest first
+func DueReloadJobs(limit int) ([]int64, error) {
+	rows, err := database.DB.Query(
+		"SELECT id FROM reload_jobs WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?",
+		models.ReloadPending, time.Now().UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ClaimReloadJob takes a due pending job for a delivery attempt by pushing its
+// next attempt lease into the future, so no other worker picks it up meanwhile
+// Returns nil if the job is not pending or not due (e.g. claimed by someone else)
+func ClaimReloadJob(id int64, lease time.Duration) (*models.ReloadJob, error) {
+	now := time.Now().UTC()
+	query := `
+		UPDATE reload_jobs
+		SET next_attempt_at = ?
+		WHERE id = ? AND status = ? AND next_attempt_at <= ?
+		RETURNING ` + reloadJobColumns
+
+	job, err := scanReloadJob(database.DB.QueryRow(query, now.Add(lease), id, models.ReloadPending, now))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// FinishReloadAttempt records the outcome of a delivery attempt of a claimed job
+// status is pending (retry at nextAttemptAt), delivered, failed or cancelled.
+// Returns false if another request was coalesced into the job since it was claimed;
+// the job then stays pending so the newer request is delivered too.
+func FinishReloadAttempt(job *models.ReloadJob, status, lastError string, nextAttemptAt time.Time) (bool, error) {
+	now := time.Now().UTC()
+
+	var deliveredAt sql.NullTime
+	if status == models.ReloadDelivered {
+		deliveredAt = sql.NullTime{Time: now, Valid: true}
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE reload_jobs
+		SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?,
+		    updated_at = ?, delivered_at = ?
+		WHERE id = ? AND coalesced = ?
+	`,
+		status,
+		lastError,
+		nextAttemptAt.UTC(),
+		now,
+		deliveredAt,
+		job.ID,
+		job.Coalesced,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetReloadJob retrieves a reload job by ID
+// Returns nil if the job does not exist
+func GetReloadJob(id int64) (*models.ReloadJob, error) {
+	job, err := scanReloadJob(database.DB.QueryRow(
+		"SELECT "+reloadJobColumns+" FROM reload_jobs WHERE id = ?", id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// GetReloadJobs retrieves the most recent reload jobs of a device, newest first
+func GetReloadJobs(deviceID string, limit int) ([]models.ReloadJob, error) {
+	return queryReloadJobs(
+		"SELECT "+reloadJobColumns+" FROM reload_jobs WHERE device_id = ? ORDER BY id DESC LIMIT ?",
+		deviceID, limit,
+	)
+}
+
+// GetReloadJobsByStatus retrieves the most recent reload jobs in any of the given states, newest first
+func GetReloadJobsByStatus(statuses []string, limit int) ([]models.ReloadJob, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")
+	args := make([]interface{}, 0, len(statuses)+1)
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	args = append(args, limit)
+
+	return queryReloadJobs(
+		"SELECT "+reloadJobColumns+" FROM reload_jobs WHERE status IN ("+placeholders+") ORDER BY id DESC LIMIT ?",
+		args...,
+	)
+}
+
+// queryReloadJobs runs a reload_jobs query and scans all rows
+func queryReloadJobs(query string, args ...interface{}) ([]models.ReloadJob, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.ReloadJob
+	for rows.Next() {
+		job, err := scanReloadJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// scanReloadJob scans a reload_jobs row (reloadJobColumns)
+func scanReloadJob(row rowScanner) (*models.ReloadJob, error) {
+	var job models.ReloadJob
+	var version sql.NullInt64
+	var reason, lastError sql.NullString
+	var nextAttemptAt, deliveredAt sql.NullTime
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(
+		&job.ID,
+		&job.DeviceID,
+		&version,
+		&reason,
+		&job.Status,
+		&job.Attempts,
+		&job.Coalesced,
+		&lastError,
+		&nextAttemptAt,
+		&createdAt,
+		&updatedAt,
+		&deliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Version = int(version.Int64)
+	job.Reason = reason.String
+	job.LastError = lastError.String
+	job.CreatedAt = createdAt.Format(time.RFC3339)
+	job.UpdatedAt = updatedAt.Format(time.RFC3339)
+	if nextAttemptAt.Valid && job.Status == models.ReloadPending {
+		job.NextAttemptAt = nextAttemptAt.Time.Format(time.RFC3339)
+	}
+	if deliveredAt.Valid {
+		job.DeliveredAt = deliveredAt.Time.Format(time.RFC3339)
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"edge-metrics-server/secrets"
+	"encoding/json"
+	"time"
+)
+
+// CreateRevision records a new revision of a device configuration
+// Returns the assigned revision number
+func CreateRevision(config *models.DeviceConfig, source string) (int, error) {
+	enabledMetrics, extraConfig, err := encodeConfigFields(config)
+	if err != nil {
+		return 0, err
+	}
+
+	// Revision numbers are assigned per device in a single statement
+	query := `
+		INSERT INTO config_revisions (device_id, revision, device_type, port, reload_port,
+		                              enabled_metrics, extra_config, ip_address, source, created_at)
+		SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ?, ?, ?, ?, ?
+		FROM config_revisions
+		WHERE device_id = ?
+	`
+
+	result, err := database.DB.Exec(query,
+		config.DeviceID,
+		config.DeviceType,
+		config.Port,
+		config.ReloadPort,
+		enabledMetrics,
+		extraConfig,
+		config.IPAddress,
+		source,
+		time.Now(),
+		config.DeviceID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	var revision int
+	err = database.DB.QueryRow("SELECT revision FROM config_revisions WHERE id = ?", id).Scan(&revision)
+	return revision, err
+}
+
+// GetRevisions retrieves all revisions of a device, newest first
+func GetRevisions(deviceID string) ([]models.ConfigRevision, error) {
+	query := `
+		SELECT device_id, revision, device_type, port, reload_port,
+		       enabled_metrics, extra_config, ip_address, source, created_at
+		FROM config_revisions
+		WHERE device_id = ?
+		ORDER BY revision DESC
+	`
+
+	rows, err := database.DB.Query(query, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.ConfigRevision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetRevision retrieves a single revision of a device
+func GetRevision(deviceID string, revision int) (*models.ConfigRevision, error) {
+	query := `
+		SELECT device_id, revision, device_type, port, reload_port,
+		       enabled_metrics, extra_config, ip_address, source, created_at
+		FROM config_revisions
+		WHERE device_id = ? AND revision = ?
+	`
+
+	result, err := scanRevision(database.DB.QueryRow(query, deviceID, revision))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Revision not found
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetLatestRevision retrieves the newest revision of a device
+func GetLatestRevision(deviceID string) (*models.ConfigRevision, error) {
+	var revision int
+	err := database.DB.QueryRow(
+		"SELECT COALESCE(MAX(revision), 0) FROM config_revisions WHERE device_id = ?", deviceID,
+	).Scan(&revision)
+	if err != nil {
+		return nil, err
+	}
+	if revision == 0 {
+		return nil, nil // No revisions recorded
+	}
+
+	return GetRevision(deviceID, revision)
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRevision scans a config_revisions row
+func scanRevision(row rowScanner) (*models.ConfigRevision, error) {
+	var revision models.ConfigRevision
+	var enabledMetrics, extraConfig, ipAddress sql.NullString
+	var createdAt time.Time
+
+	err := row.Scan(
+		&revision.DeviceID,
+		&revision.Revision,
+		&revision.Config.DeviceType,
+		&revision.Config.Port,
+		&revision.Config.ReloadPort,
+		&enabledMetrics,
+		&extraConfig,
+		&ipAddress,
+		&revision.Source,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Config.DeviceID = revision.DeviceID
+	revision.CreatedAt = createdAt.Format(time.RFC3339)
+
+	if ipAddress.Valid {
+		revision.Config.IPAddress = ipAddress.String
+	}
+
+	if enabledMetrics.Valid && enabledMetrics.String != "" {
+		if err := json.Unmarshal([]byte(enabledMetrics.String), &revision.Config.EnabledMetrics); err != nil {
+			return nil, err
+		}
+	}
+
+	if extraConfig.Valid && extraConfig.String != "" {
+		revision.Config.ExtraConfig = make(map[string]interface{})
+		if err := json.Unmarshal([]byte(extraConfig.String), &revision.Config.ExtraConfig); err != nil {
+			return nil, err
+		}
+		secrets.Open(revision.Config.ExtraConfig)
+	}
+
+	return &revision, nil
+}
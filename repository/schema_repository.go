@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"encoding/json"
+	"time"
+)
+
+// GetConfigSchema retrieves the schema of an extra config block of a device type
+// Returns nil if no schema is registered
+func GetConfigSchema(deviceType, block string) (*models.ConfigSchema, error) {
+	query := `
+		SELECT device_type, block, schema, created_at, updated_at
+		FROM config_schemas
+		WHERE device_type = ? AND block = ?
+	`
+
+	schema, err := scanConfigSchema(database.DB.QueryRow(query, deviceType, block))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return schema, err
+}
+
+// GetConfigSchemas retrieves the schemas of a device type
+// Returns all schemas if deviceType is empty
+func GetConfigSchemas(deviceType string) ([]models.ConfigSchema, error) {
+	query := `
+		SELECT device_type, block, schema, created_at, updated_at
+		FROM config_schemas
+		WHERE ? = '' OR device_type = ?
+		ORDER BY device_type, block
+	`
+
+	rows, err := database.DB.Query(query, deviceType, deviceType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schemas []models.ConfigSchema
+	for rows.Next() {
+		schema, err := scanConfigSchema(rows)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, *schema)
+	}
+
+	return schemas, rows.Err()
+}
+
+// SaveConfigSchema creates or replaces the schema of an extra config block
+func SaveConfigSchema(schema *models.ConfigSchema) error {
+	raw, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO config_schemas (device_type, block, schema, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(device_type, block) DO UPDATE SET
+			schema = excluded.schema,
+			updated_at = excluded.updated_at
+	`
+
+	now := time.Now()
+	_, err = database.DB.Exec(query,
+		schema.DeviceType,
+		schema.Block,
+		string(raw),
+		now,
+		now,
+	)
+	return err
+}
+
+// DeleteConfigSchema deletes the schema of an extra config block
+func DeleteConfigSchema(deviceType, block string) error {
+	result, err := database.DB.Exec(
+		"DELETE FROM config_schemas WHERE device_type = ? AND block = ?",
+		deviceType, block,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// scanConfigSchema scans a config_schemas row
+func scanConfigSchema(row rowScanner) (*models.ConfigSchema, error) {
+	var schema models.ConfigSchema
+	var raw string
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(
+		&schema.DeviceType,
+		&schema.Block,
+		&raw,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	schema.CreatedAt = createdAt.Format(time.RFC3339)
+	schema.UpdatedAt = updatedAt.Format(time.RFC3339)
+
+	if err := json.Unmarshal([]byte(raw), &schema.Schema); err != nil {
+		return nil, err
+	}
+
+	return &schema, nil
+}
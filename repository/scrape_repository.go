@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"encoding/json"
+	"time"
+)
+
+// GetScrapeSettings retrieves the scrape settings of a device type
+// Returns nil if no settings are stored
+func GetScrapeSettings(deviceType string) (*models.ScrapeSettings, error) {
+	query := `
+		SELECT device_type, interval, scrape_timeout, metrics_path, relabelings, created_at, updated_at
+		FROM scrape_settings
+		WHERE device_type = ?
+	`
+
+	settings, err := scanScrapeSettings(database.DB.QueryRow(query, deviceType))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return settings, err
+}
+
+// GetAllScrapeSettings retrieves the scrape settings of all device types
+func GetAllScrapeSettings() ([]models.ScrapeSettings, error) {
+	query := `
+		SELECT device_type, interval, scrape_timeout, metrics_path, relabelings, created_at, updated_at
+		FROM scrape_settings
+		ORDER BY device_type
+	`
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []models.ScrapeSettings
+	for rows.Next() {
+		settings, err := scanScrapeSettings(rows)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, *settings)
+	}
+
+	return all, rows.Err()
+}
+
+// SaveScrapeSettings creates or replaces the scrape settings of a device type
+func SaveScrapeSettings(settings *models.ScrapeSettings) error {
+	relabelings, err := json.Marshal(settings.Relabelings)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO scrape_settings (device_type, interval, scrape_timeout, metrics_path, relabelings, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(device_type) DO UPDATE SET
+			interval = excluded.interval,
+			scrape_timeout = excluded.scrape_timeout,
+			metrics_path = excluded.metrics_path,
+			relabelings = excluded.relabelings,
+			updated_at = excluded.updated_at
+	`
+
+	now := time.Now()
+	_, err = database.DB.Exec(query,
+		settings.DeviceType,
+		settings.Interval,
+		settings.ScrapeTimeout,
+		settings.MetricsPath,
+		string(relabelings),
+		now,
+		now,
+	)
+	return err
+}
+
+// DeleteScrapeSettings deletes the scrape settings of a device type
+func DeleteScrapeSettings(deviceType string) error {
+	result, err := database.DB.Exec("DELETE FROM scrape_settings WHERE device_type = ?", deviceType)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// scanScrapeSettings scans a scrape_settings row
+func scanScrapeSettings(row rowScanner) (*models.ScrapeSettings, error) {
+	var settings models.ScrapeSettings
+	var scrapeTimeout, relabelings sql.NullString
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(
+		&settings.DeviceType,
+		&settings.Interval,
+		&scrapeTimeout,
+		&settings.MetricsPath,
+		&relabelings,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.ScrapeTimeout = scrapeTimeout.String
+	settings.CreatedAt = createdAt.Format(time.RFC3339)
+	settings.UpdatedAt = updatedAt.Format(time.RFC3339)
+
+	settings.Relabelings = []models.RelabelConfig{}
+	if relabelings.Valid && relabelings.String != "" && relabelings.String != "null" {
+		if err := json.Unmarshal([]byte(relabelings.String), &settings.Relabelings); err != nil {
+			return nil, err
+		}
+	}
+
+	return &settings, nil
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"edge-metrics-server/secrets"
+	"encoding/json"
+	"time"
+)
+
+// GetSecretPaths retrieves all secret paths, ordered by path
+func GetSecretPaths() ([]models.SecretPath, error) {
+	rows, err := database.DB.Query("SELECT path, created_at FROM secret_paths ORDER BY path")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []models.SecretPath
+	for rows.Next() {
+		var path models.SecretPath
+		var createdAt sql.NullTime
+		if err := rows.Scan(&path.Path, &createdAt); err != nil {
+			return nil, err
+		}
+		if createdAt.Valid {
+			path.CreatedAt = createdAt.Time.Format(time.RFC3339)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// AddSecretPath marks a path as secret
+// Returns false if the path was already secret
+func AddSecretPath(path string) (bool, error) {
+	result, err := database.DB.Exec(
+		"INSERT OR IGNORE INTO secret_paths (path, created_at) VALUES (?, ?)",
+		path, time.Now().UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// DeleteSecretPath removes a secret path
+// Returns sql.ErrNoRows if the path is not secret
+func DeleteSecretPath(path string) error {
+	result, err := database.DB.Exec("DELETE FROM secret_paths WHERE path = ?", path)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ResealSecrets rewrites the stored extra configs of devices, config revisions,
+// profiles and device templates after the secret paths changed: values at new secret paths are encrypted,
+// values at paths that are no longer secret are decrypted. Versions are not changed.
+// Returns the number of rewritten rows.
+func ResealSecrets() (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	tables := []struct {
+		table, key, column string
+	}{
+		{"devices", "device_id", "extra_config"},
+		{"config_revisions", "id", "extra_config"},
+		{"profiles", "name", "config"},
+		{"device_templates", "device_type", "extra_config"},
+	}
+
+	total := 0
+	for _, t := range tables {
+		n, err := resealColumn(tx, t.table, t.key, t.column)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// resealColumn re-encrypts a JSON column holding an extra config
+func resealColumn(tx *sql.Tx, table, key, column string) (int, error) {
+	rows, err := tx.Query("SELECT " + key + ", " + column + " FROM " + table + " WHERE " + column + " IS NOT NULL AND " + column + " != ''")
+	if err != nil {
+		return 0, err
+	}
+
+	updates := make(map[interface{}]string)
+	for rows.Next() {
+		var id interface{}
+		var stored string
+		if err := rows.Scan(&id, &stored); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		config := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(stored), &config); err != nil {
+			continue // Not an object, nothing to reseal
+		}
+		sealed, err := secrets.Reseal(config)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		data, err := json.Marshal(sealed)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		if string(data) != stored {
+			updates[id] = string(data)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, data := range updates {
+		if _, err := tx.Exec("UPDATE "+table+" SET "+column+" = ? WHERE "+key+" = ?", data, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(updates), nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"encoding/json"
+	"time"
+)
+
+// SaveSyncState stores the result of a running config comparison for a device
+// applied_revision and synced_at are only updated by in_sync results, so they
+// keep the last confirmed revision while a device is drifted or unreachable
+func SaveSyncState(state *models.DeviceSyncState, checkedAt time.Time) error {
+	var diffJSON sql.NullString
+	if len(state.Diff) > 0 {
+		data, err := json.Marshal(state.Diff)
+		if err != nil {
+			return err
+		}
+		diffJSON = sql.NullString{String: string(data), Valid: true}
+	}
+
+	var appliedRevision sql.NullInt64
+	var syncedAt sql.NullTime
+	if state.Status == models.SyncInSync {
+		appliedRevision = sql.NullInt64{Int64: int64(state.AppliedRevision), Valid: state.AppliedRevision > 0}
+		syncedAt = sql.NullTime{Time: checkedAt, Valid: true}
+	}
+
+	query := `
+		INSERT INTO device_sync_state (device_id, status, config_version, applied_revision, diff, error, checked_at, synced_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(device_id) DO UPDATE SET
+			status = excluded.status,
+			config_version = excluded.config_version,
+			applied_revision = CASE WHEN excluded.status = 'in_sync'
+				THEN excluded.applied_revision ELSE device_sync_state.applied_revision END,
+			diff = excluded.diff,
+			error = excluded.error,
+			checked_at = excluded.checked_at,
+			synced_at = COALESCE(excluded.synced_at, device_sync_state.synced_at)
+	`
+
+	_, err := database.DB.Exec(query,
+		state.DeviceID,
+		state.Status,
+		state.ConfigVersion,
+		appliedRevision,
+		diffJSON,
+		state.Error,
+		checkedAt,
+		syncedAt,
+	)
+	return err
+}
+
+// GetSyncState retrieves the latest sync state of a device
+// Returns nil if the device has not been checked yet
+func GetSyncState(deviceID string) (*models.DeviceSyncState, error) {
+	query := `
+		SELECT device_id, status, config_version, applied_revision, diff, error, checked_at, synced_at
+		FROM device_sync_state
+		WHERE device_id = ?
+	`
+
+	state, err := scanSyncState(database.DB.QueryRow(query, deviceID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Not checked yet
+		}
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// GetAllSyncStates retrieves the latest sync state of all checked devices, keyed by device ID
+func GetAllSyncStates() (map[string]models.DeviceSyncState, error) {
+	query := `
+		SELECT device_id, status, config_version, applied_revision, diff, error, checked_at, synced_at
+		FROM device_sync_state
+	`
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]models.DeviceSyncState)
+	for rows.Next() {
+		state, err := scanSyncState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states[state.DeviceID] = *state
+	}
+
+	return states, rows.Err()
+}
+
+// DeleteSyncState removes the sync state of a device
+func DeleteSyncState(deviceID string) error {
+	_, err := database.DB.Exec("DELETE FROM device_sync_state WHERE device_id = ?", deviceID)
+	return err
+}
+
+// scanSyncState scans a device_sync_state row
+func scanSyncState(row rowScanner) (*models.DeviceSyncState, error) {
+	var state models.DeviceSyncState
+	var configVersion, appliedRevision sql.NullInt64
+	var diffJSON, errMsg sql.NullString
+	var checkedAt, syncedAt sql.NullTime
+
+	err := row.Scan(
+		&state.DeviceID,
+		&state.Status,
+		&configVersion,
+		&appliedRevision,
+		&diffJSON,
+		&errMsg,
+		&checkedAt,
+		&syncedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	state.ConfigVersion = int(configVersion.Int64)
+	state.AppliedRevision = int(appliedRevision.Int64)
+	state.Error = errMsg.String
+	if diffJSON.Valid && diffJSON.String != "" {
+		if err := json.Unmarshal([]byte(diffJSON.String), &state.Diff); err != nil {
+			return nil, err
+		}
+	}
+	if checkedAt.Valid {
+		state.CheckedAt = checkedAt.Time.Format(time.RFC3339)
+	}
+	if syncedAt.Valid {
+		state.SyncedAt = syncedAt.Time.Format(time.RFC3339)
+	}
+
+	return &state, nil
+}
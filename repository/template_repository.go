@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"edge-metrics-server/secrets"
+	"encoding/json"
+	"time"
+)
+
+// GetTemplate retrieves the template of a device type
+// Returns nil if no template is stored
+func GetTemplate(deviceType string) (*models.DeviceTemplate, error) {
+	query := `
+		SELECT device_type, port, reload_port, enabled_metrics, extra_config, created_at, updated_at
+		FROM device_templates
+		WHERE device_type = ?
+	`
+
+	template, err := scanTemplate(database.DB.QueryRow(query, deviceType))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return template, err
+}
+
+// GetAllTemplates retrieves the templates of all device types
+func GetAllTemplates() ([]models.DeviceTemplate, error) {
+	query := `
+		SELECT device_type, port, reload_port, enabled_metrics, extra_config, created_at, updated_at
+		FROM device_templates
+		ORDER BY device_type
+	`
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []models.DeviceTemplate
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *template)
+	}
+
+	return templates, rows.Err()
+}
+
+// SaveTemplate creates or replaces the template of a device type
+func SaveTemplate(template *models.DeviceTemplate) error {
+	enabledMetrics, extraConfig, err := encodeTemplateFields(template)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO device_templates (device_type, port, reload_port, enabled_metrics, extra_config, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(device_type) DO UPDATE SET
+			port = excluded.port,
+			reload_port = excluded.reload_port,
+			enabled_metrics = excluded.enabled_metrics,
+			extra_config = excluded.extra_config,
+			updated_at = excluded.updated_at
+	`
+
+	now := time.Now()
+	_, err = database.DB.Exec(query,
+		template.DeviceType,
+		template.Port,
+		template.ReloadPort,
+		enabledMetrics,
+		extraConfig,
+		now,
+		now,
+	)
+	return err
+}
+
+// SeedTemplate stores a template unless the device type was seeded before or
+// already has one. Seeded device types are recorded, so a deleted template is not
+// seeded again.
+// Returns true if the template was created
+func SeedTemplate(template *models.DeviceTemplate) (bool, error) {
+	enabledMetrics, extraConfig, err := encodeTemplateFields(template)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() // No-op after commit
+
+	result, err := tx.Exec("INSERT OR IGNORE INTO template_seeds (device_type, seeded_at) VALUES (?, ?)",
+		template.DeviceType, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if seeded, err := result.RowsAffected(); err != nil || seeded == 0 {
+		return false, err
+	}
+
+	query := `
+		INSERT OR IGNORE INTO device_templates (device_type, port, reload_port, enabled_metrics, extra_config)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	result, err = tx.Exec(query,
+		template.DeviceType,
+		template.Port,
+		template.ReloadPort,
+		enabledMetrics,
+		extraConfig,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, tx.Commit()
+}
+
+// DeleteTemplate deletes the template of a device type
+func DeleteTemplate(deviceType string) error {
+	result, err := database.DB.Exec("DELETE FROM device_templates WHERE device_type = ?", deviceType)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// encodeTemplateFields converts enabled_metrics and extra_config to JSON columns
+// Values at secret paths are encrypted.
+func encodeTemplateFields(template *models.DeviceTemplate) (string, string, error) {
+	enabledMetrics, err := json.Marshal(template.EnabledMetrics)
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed, err := secrets.Seal(template.ExtraConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	extraConfig, err := json.Marshal(sealed)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(enabledMetrics), string(extraConfig), nil
+}
+
+// scanTemplate scans a device_templates row
+func scanTemplate(row rowScanner) (*models.DeviceTemplate, error) {
+	var template models.DeviceTemplate
+	var port, reloadPort sql.NullInt64
+	var enabledMetrics, extraConfig sql.NullString
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(
+		&template.DeviceType,
+		&port,
+		&reloadPort,
+		&enabledMetrics,
+		&extraConfig,
+		&createdAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	template.Port = int(port.Int64)
+	template.ReloadPort = int(reloadPort.Int64)
+	template.CreatedAt = createdAt.Format(time.RFC3339)
+	template.UpdatedAt = updatedAt.Format(time.RFC3339)
+
+	template.EnabledMetrics = []string{}
+	if enabledMetrics.Valid && enabledMetrics.String != "" && enabledMetrics.String != "null" {
+		if err := json.Unmarshal([]byte(enabledMetrics.String), &template.EnabledMetrics); err != nil {
+			return nil, err
+		}
+	}
+
+	template.ExtraConfig = make(map[string]interface{})
+	if extraConfig.Valid && extraConfig.String != "" && extraConfig.String != "null" {
+		if err := json.Unmarshal([]byte(extraConfig.String), &template.ExtraConfig); err != nil {
+			return nil, err
+		}
+		secrets.Open(template.ExtraConfig)
+	}
+
+	return &template, nil
+}
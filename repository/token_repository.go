@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"database/sql"
+	"edge-metrics-server/database"
+	"edge-metrics-server/models"
+	"time"
+)
+
+// CreateAPIToken stores a new API token
+// token.ID and token.CreatedAt are set on success
+func CreateAPIToken(token *models.APIToken, expiresAt *time.Time) error {
+	var expires sql.NullTime
+	if expiresAt != nil {
+		expires = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+	}
+
+	now := time.Now().UTC()
+	result, err := database.DB.Exec(`
+		INSERT INTO api_tokens (name, role, token_hash, prefix, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		token.Name,
+		token.Role,
+		token.TokenHash,
+		token.Prefix,
+		now,
+		expires,
+	)
+	if err != nil {
+		return err
+	}
+
+	token.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.CreatedAt = now.Format(time.RFC3339)
+	if expiresAt != nil {
+		token.ExpiresAt = expires.Time.Format(time.RFC3339)
+	}
+	return nil
+}
+
+// GetAPITokenByHash retrieves an API token by the SHA-256 hash of the token
+// Returns nil if no token matches
+func GetAPITokenByHash(tokenHash string) (*models.APIToken, error) {
+	query := `
+		SELECT id, name, role, token_hash, prefix, created_at, expires_at, last_used_at
+		FROM api_tokens
+		WHERE token_hash = ?
+	`
+
+	token, err := scanAPIToken(database.DB.QueryRow(query, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetAPITokens retrieves all API tokens, ordered by name
+func GetAPITokens() ([]models.APIToken, error) {
+	query := `
+		SELECT id, name, role, token_hash, prefix, created_at, expires_at, last_used_at
+		FROM api_tokens
+		ORDER BY name
+	`
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// CountAPITokens returns the number of API tokens
+func CountAPITokens() (int, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM api_tokens").Scan(&count)
+	return count, err
+}
+
+// TouchAPIToken records the use of an API token
+func TouchAPIToken(id int64, usedAt time.Time) error {
+	_, err := database.DB.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", usedAt.UTC(), id)
+	return err
+}
+
+// DeleteAPIToken removes an API token
+// Returns sql.ErrNoRows if the token does not exist
+func DeleteAPIToken(id int64) error {
+	result, err := database.DB.Exec("DELETE FROM api_tokens WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// scanAPIToken scans an api_tokens row
+func scanAPIToken(row rowScanner) (*models.APIToken, error) {
+	var token models.APIToken
+	var createdAt time.Time
+	var expiresAt, lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&token.ID,
+		&token.Name,
+		&token.Role,
+		&token.TokenHash,
+		&token.Prefix,
+		&createdAt,
+		&expiresAt,
+		&lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	token.CreatedAt = createdAt.Format(time.RFC3339)
+	if expiresAt.Valid {
+		token.ExpiresAt = expiresAt.Time.Format(time.RFC3339)
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = lastUsedAt.Time.Format(time.RFC3339)
+	}
+
+	return &token, nil
+}
@@ -1,42 +1,122 @@
 package router
 
 import (
+	"edge-metrics-server/auth"
 	"edge-metrics-server/handlers"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes configures all API routes
+// Routes are grouped by the role they require when authentication is enabled;
+// exporter-facing routes stay public, checking device tokens where the device is known.
 func SetupRoutes(r *gin.Engine) {
+	public := r.Group("")
+	viewer := r.Group("", auth.Require(auth.RoleViewer))
+	operator := r.Group("", auth.Require(auth.RoleOperator))
+	admin := r.Group("", auth.Require(auth.RoleAdmin))
+	device := public.Group("", auth.RequireDevice())
+
 	// Config routes
-	r.GET("/config", handlers.ListConfigs)
-	r.GET("/config/:device_id", handlers.GetConfig)
-	r.POST("/config/:device_id", handlers.CreateConfig)
-	r.PUT("/config/:device_id", handlers.UpdateConfig)
-	r.PATCH("/config/:device_id", handlers.PatchConfig)
-	r.DELETE("/config/:device_id", handlers.DeleteConfig)
+	viewer.GET("/config", handlers.ListConfigs)
+	device.GET("/config/:device_id", handlers.GetConfig)
+	operator.POST("/config/:device_id", handlers.CreateConfig)
+	operator.PUT("/config/:device_id", handlers.UpdateConfig)
+	operator.PATCH("/config/:device_id", handlers.PatchConfig)
+	admin.DELETE("/config/:device_id", handlers.DeleteConfig)
+	device.GET("/config/:device_id/watch", handlers.WatchConfig)
+
+	// Config revision routes
+	viewer.GET("/config/:device_id/revisions", handlers.ListRevisions)
+	viewer.GET("/config/:device_id/revisions/:revision", handlers.GetRevision)
+	viewer.GET("/config/:device_id/diff", handlers.DiffRevisions)
+	operator.POST("/config/:device_id/rollback", handlers.RollbackConfig)
 
 	// Device routes
-	r.GET("/devices", handlers.ListDevices)
-	r.POST("/devices/reload", handlers.ReloadAllDevices)
-	r.GET("/devices/:device_id/status", handlers.GetDeviceStatus)
-	r.PATCH("/devices/:device_id", handlers.PatchDevice)
-	r.GET("/devices/:device_id/local-config", handlers.GetDeviceLocalConfig)
-	r.POST("/devices/:device_id/reload", handlers.ReloadDevice)
+	viewer.GET("/devices", handlers.ListDevices)
+	operator.POST("/devices/reload", handlers.ReloadAllDevices)
+	public.POST("/devices/enroll", handlers.EnrollDevice)
+	viewer.GET("/devices/:device_id/status", handlers.GetDeviceStatus)
+	operator.PATCH("/devices/:device_id", handlers.PatchDevice)
+	viewer.GET("/devices/:device_id/local-config", handlers.GetDeviceLocalConfig)
+	operator.POST("/devices/:device_id/reload", handlers.ReloadDevice)
+	viewer.GET("/devices/:device_id/reloads", handlers.GetDeviceReloads)
+	viewer.GET("/devices/:device_id/drift", handlers.GetDeviceDrift)
+	operator.POST("/devices/:device_id/approve", handlers.ApproveDevice)
+	operator.POST("/devices/:device_id/reject", handlers.RejectDevice)
+	device.POST("/devices/:device_id/heartbeat", handlers.DeviceHeartbeat)
+	viewer.GET("/devices/:device_id/events", handlers.GetDeviceEvents)
+	viewer.GET("/devices/:device_id/credential", handlers.GetDeviceCredential)
+	admin.POST("/devices/:device_id/credential/rotate", handlers.RotateDeviceCredential)
+
+	// Reload outbox routes
+	viewer.GET("/reloads", handlers.ListReloads)
+
+	// Drift routes
+	viewer.GET("/drift", handlers.GetDriftReport)
+
+	// Device template routes
+	viewer.GET("/templates", handlers.ListTemplates)
+	viewer.GET("/templates/:device_type", handlers.GetTemplate)
+	operator.PUT("/templates/:device_type", handlers.PutTemplate)
+	admin.DELETE("/templates/:device_type", handlers.DeleteTemplate)
+
+	// Config schema routes
+	viewer.GET("/schemas", handlers.ListSchemas)
+	viewer.GET("/schemas/:device_type", handlers.GetDeviceTypeSchemas)
+	viewer.GET("/schemas/:device_type/:block", handlers.GetSchema)
+	operator.PUT("/schemas/:device_type/:block", handlers.PutSchema)
+	admin.DELETE("/schemas/:device_type/:block", handlers.DeleteSchema)
+
+	// Profile routes
+	viewer.GET("/profiles", handlers.ListProfiles)
+	viewer.GET("/profiles/:name", handlers.GetProfile)
+	operator.PUT("/profiles/:name", handlers.PutProfile)
+	admin.DELETE("/profiles/:name", handlers.DeleteProfile)
+
+	// Bulk routes (select devices by device_ids, device_type or label selector)
+	operator.POST("/bulk/config/patch", handlers.BulkPatchConfig)
+	operator.POST("/bulk/devices/reload", handlers.BulkReloadDevices)
 
 	// Metrics routes
-	r.GET("/metrics/summary", handlers.GetMetricsSummary)
+	viewer.GET("/metrics/summary", handlers.GetMetricsSummary)
+
+	// Catalog routes
+	viewer.GET("/catalog", handlers.GetCatalog)
+	viewer.GET("/catalog/:device_type", handlers.GetDeviceTypeCatalog)
+
+	// Scrape settings routes
+	viewer.GET("/scrape-settings", handlers.ListScrapeSettings)
+	viewer.GET("/scrape-settings/:device_type", handlers.GetScrapeSettings)
+	operator.PUT("/scrape-settings/:device_type", handlers.PutScrapeSettings)
+	admin.DELETE("/scrape-settings/:device_type", handlers.DeleteScrapeSettings)
+
+	// Service discovery routes
+	viewer.GET("/discovery/targets", handlers.GetHTTPSDTargets)
 
 	// Kubernetes routes
-	r.GET("/kubernetes/status", handlers.GetKubernetesStatus)
-	r.GET("/kubernetes/health", handlers.GetKubernetesHealth)
-	r.POST("/kubernetes/sync", handlers.SyncKubernetes)
-	r.POST("/kubernetes/sync/:device_id", handlers.SyncSingleDevice)
-	r.GET("/kubernetes/manifests", handlers.GetManifests)
-	r.GET("/kubernetes/resources/:device_id", handlers.GetDeviceResources)
-	r.DELETE("/kubernetes/resources/:device_id", handlers.DeleteDeviceResources)
-	r.DELETE("/kubernetes/cleanup", handlers.CleanupKubernetes)
+	viewer.GET("/kubernetes/status", handlers.GetKubernetesStatus)
+	viewer.GET("/kubernetes/health", handlers.GetKubernetesHealth)
+	operator.POST("/kubernetes/sync", handlers.SyncKubernetes)
+	operator.POST("/kubernetes/sync/:device_id", handlers.SyncSingleDevice)
+	viewer.GET("/kubernetes/manifests", handlers.GetManifests)
+	viewer.GET("/kubernetes/monitors", handlers.GetMonitors)
+	operator.POST("/kubernetes/monitors/sync", handlers.SyncMonitors)
+	viewer.GET("/kubernetes/resources/:device_id", handlers.GetDeviceResources)
+	admin.DELETE("/kubernetes/resources/:device_id", handlers.DeleteDeviceResources)
+	admin.DELETE("/kubernetes/cleanup", handlers.CleanupKubernetes)
+
+	// Secret path routes (extra config values encrypted at rest)
+	viewer.GET("/secret-paths", handlers.ListSecretPaths)
+	admin.PUT("/secret-paths/:path", handlers.PutSecretPath)
+	admin.DELETE("/secret-paths/:path", handlers.DeleteSecretPath)
+
+	// Auth routes
+	viewer.GET("/auth/whoami", handlers.WhoAmI)
+	admin.GET("/auth/tokens", handlers.ListAPITokens)
+	admin.POST("/auth/tokens", handlers.CreateAPIToken)
+	admin.DELETE("/auth/tokens/:id", handlers.DeleteAPIToken)
 
 	// Health route
-	r.GET("/health", handlers.Health)
+	public.GET("/health", handlers.Health)
 }
@@ -0,0 +1,383 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"edge-metrics-server/models"
+)
+
+// Schema is a compiled subset of JSON Schema used to validate extra config blocks
+// Supported keywords: type, properties, required, additionalProperties, items, enum,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength, maxLength,
+// pattern, minItems, maxItems (title, description, default, $schema and $id are ignored)
+type Schema struct {
+	types                []string
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	noAdditional         bool
+	items                *Schema
+	enum                 []interface{}
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	minLength            *int
+	maxLength            *int
+	minItems             *int
+	maxItems             *int
+	pattern              *regexp.Regexp
+}
+
+// validTypes are the JSON Schema type names
+var validTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// annotationKeywords are accepted but have no effect on validation
+var annotationKeywords = map[string]bool{
+	"$schema": true, "$id": true, "title": true, "description": true, "default": true, "examples": true,
+}
+
+// Compile checks a JSON Schema document and compiles it for validation
+// Unsupported keywords are rejected so that a schema never silently validates less than it says
+func Compile(raw map[string]interface{}) (*Schema, error) {
+	return compile(raw, "")
+}
+
+func compile(raw map[string]interface{}, path string) (*Schema, error) {
+	s := &Schema{}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := raw[key]
+		at := joinPath(path, key)
+
+		switch key {
+		case "type":
+			switch v := value.(type) {
+			case string:
+				s.types = []string{v}
+			case []interface{}:
+				for _, t := range v {
+					name, ok := t.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: must be a string or an array of strings", at)
+					}
+					s.types = append(s.types, name)
+				}
+			default:
+				return nil, fmt.Errorf("%s: must be a string or an array of strings", at)
+			}
+			for _, t := range s.types {
+				if !validTypes[t] {
+					return nil, fmt.Errorf("%s: unknown type %q", at, t)
+				}
+			}
+
+		case "properties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an object", at)
+			}
+			s.properties = make(map[string]*Schema, len(props))
+			for name, prop := range props {
+				propRaw, ok := prop.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s: must be an object", joinPath(at, name))
+				}
+				compiled, err := compile(propRaw, joinPath(at, name))
+				if err != nil {
+					return nil, err
+				}
+				s.properties[name] = compiled
+			}
+
+		case "required":
+			names, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an array of strings", at)
+			}
+			for _, n := range names {
+				name, ok := n.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: must be an array of strings", at)
+				}
+				s.required = append(s.required, name)
+			}
+
+		case "additionalProperties":
+			switch v := value.(type) {
+			case bool:
+				s.noAdditional = !v
+			case map[string]interface{}:
+				compiled, err := compile(v, at)
+				if err != nil {
+					return nil, err
+				}
+				s.additionalProperties = compiled
+			default:
+				return nil, fmt.Errorf("%s: must be a boolean or an object", at)
+			}
+
+		case "items":
+			itemsRaw, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an object", at)
+			}
+			compiled, err := compile(itemsRaw, at)
+			if err != nil {
+				return nil, err
+			}
+			s.items = compiled
+
+		case "enum":
+			values, ok := value.([]interface{})
+			if !ok || len(values) == 0 {
+				return nil, fmt.Errorf("%s: must be a non-empty array", at)
+			}
+			s.enum = values
+
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			n, ok := toFloat(value)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a number", at)
+			}
+			switch key {
+			case "minimum":
+				s.minimum = &n
+			case "maximum":
+				s.maximum = &n
+			case "exclusiveMinimum":
+				s.exclusiveMinimum = &n
+			case "exclusiveMaximum":
+				s.exclusiveMaximum = &n
+			}
+
+		case "minLength", "maxLength", "minItems", "maxItems":
+			n, ok := toFloat(value)
+			if !ok || n < 0 || n != math.Trunc(n) {
+				return nil, fmt.Errorf("%s: must be a non-negative integer", at)
+			}
+			limit := int(n)
+			switch key {
+			case "minLength":
+				s.minLength = &limit
+			case "maxLength":
+				s.maxLength = &limit
+			case "minItems":
+				s.minItems = &limit
+			case "maxItems":
+				s.maxItems = &limit
+			}
+
+		case "pattern":
+			expr, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a string", at)
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid regular expression: %v", at, err)
+			}
+			s.pattern = re
+
+		default:
+			if !annotationKeywords[key] {
+				return nil, fmt.Errorf("%s: unsupported keyword", at)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Validate checks a decoded JSON value against the schema
+// path prefixes the field paths of the returned errors (e.g. "shelly")
+func (s *Schema) Validate(value interface{}, path string) []models.FieldError {
+	var errs []models.FieldError
+	s.validate(value, path, &errs)
+	return errs
+}
+
+func (s *Schema) validate(value interface{}, path string, errs *[]models.FieldError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, models.FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.types) > 0 && !s.matchesType(value) {
+		fail("must be of type %s, got %s", joinTypes(s.types), typeOf(value))
+		return
+	}
+
+	if s.enum != nil {
+		found := false
+		for _, allowed := range s.enum {
+			if equalJSON(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", s.enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, models.FieldError{Path: joinPath(path, name), Message: "is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if prop, ok := s.properties[key]; ok {
+				prop.validate(v[key], joinPath(path, key), errs)
+			} else if s.noAdditional {
+				*errs = append(*errs, models.FieldError{Path: joinPath(path, key), Message: "is not allowed"})
+			} else if s.additionalProperties != nil {
+				s.additionalProperties.validate(v[key], joinPath(path, key), errs)
+			}
+		}
+
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, path+"["+strconv.Itoa(i)+"]", errs)
+			}
+		}
+
+	case string:
+		length := len([]rune(v))
+		if s.minLength != nil && length < *s.minLength {
+			fail("must be at least %d characters long", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			fail("must be at most %d characters long", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %s", s.pattern.String())
+		}
+
+	default:
+		n, ok := toFloat(value)
+		if !ok {
+			return
+		}
+		if s.minimum != nil && n < *s.minimum {
+			fail("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && n > *s.maximum {
+			fail("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum {
+			fail("must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && n >= *s.exclusiveMaximum {
+			fail("must be < %v", *s.exclusiveMaximum)
+		}
+	}
+}
+
+// matchesType checks the value against any of the allowed types
+func (s *Schema) matchesType(value interface{}) bool {
+	actual := typeOf(value)
+	for _, t := range s.types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type name of a decoded JSON value
+// Whole numbers are reported as integer
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	if n, ok := toFloat(value); ok {
+		if n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// toFloat converts numeric values to float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// equalJSON compares two decoded JSON values, treating all numbers alike
+func equalJSON(a, b interface{}) bool {
+	na, aIsNum := toFloat(a)
+	nb, bIsNum := toFloat(b)
+	if aIsNum || bIsNum {
+		return aIsNum && bIsNum && na == nb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// joinTypes formats a list of type names for error messages
+func joinTypes(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("%v", types)
+}
+
+// joinPath appends a key to a dotted field path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,393 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secret values in API responses. Writing it back leaves the
+// stored value unchanged (see Restore).
+const Redacted = "********"
+
+// encryptedPrefix marks encrypted values stored in place of secret values
+// (version 1: AES-256-GCM, base64 of nonce followed by ciphertext)
+const encryptedPrefix = "enc:v1:"
+
+// ErrNoKey is returned when a secret value has to be encrypted but no key is configured
+var ErrNoKey = errors.New("no config encryption key configured")
+
+var (
+	mu    sync.RWMutex
+	aead  cipher.AEAD
+	paths []string
+)
+
+// ParseKey decodes a 32-byte AES-256 key given as base64 or hex
+func ParseKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if key, err := hex.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key must be 32 bytes, base64 or hex encoded")
+}
+
+// Configure sets the key secret values are encrypted with
+func Configure(key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	aead = gcm
+	return nil
+}
+
+// Enabled reports whether an encryption key is configured
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return aead != nil
+}
+
+// SetPaths sets the secret paths (dotted paths into extra config, e.g. shelly.password)
+func SetPaths(list []string) {
+	mu.Lock()
+	defer mu.Unlock()
+	paths = append([]string(nil), list...)
+}
+
+// Paths returns the secret paths
+func Paths() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]string(nil), paths...)
+}
+
+// IsSecret reports whether a dotted path is a secret path or lies inside one
+func IsSecret(path string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return isSecret(path)
+}
+
+// isSecret is IsSecret with mu held
+func isSecret(path string) bool {
+	for _, secret := range paths {
+		if path == secret || strings.HasPrefix(path, secret+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// containsSecret reports whether a secret path lies inside a dotted path (mu held)
+func containsSecret(path string) bool {
+	for _, secret := range paths {
+		if strings.HasPrefix(secret, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Seal returns a copy of an extra config with the values at secret paths encrypted
+// Values that are already encrypted are kept as they are.
+func Seal(config map[string]interface{}) (map[string]interface{}, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(paths) == 0 {
+		return config, nil
+	}
+
+	sealed, err := sealMap("", config)
+	if err != nil {
+		return nil, err
+	}
+	return sealed, nil
+}
+
+// sealMap encrypts the secret values of a JSON object (mu held)
+func sealMap(prefix string, object map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		path := joinPath(prefix, key)
+		switch {
+		case isSecret(path):
+			if value == nil || isEncrypted(value) {
+				result[key] = value
+				continue
+			}
+			encrypted, err := encrypt(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encrypt %s: %w", path, err)
+			}
+			result[key] = encrypted
+		case containsSecret(path):
+			if child, ok := value.(map[string]interface{}); ok {
+				sealed, err := sealMap(path, child)
+				if err != nil {
+					return nil, err
+				}
+				result[key] = sealed
+				continue
+			}
+			result[key] = value
+		default:
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+// SealString encrypts a secret stored outside extra config (e.g. a device signing
+// key) if an encryption key is configured; without one the value is returned
+// unchanged. Values that are already encrypted are kept as they are.
+func SealString(value string) (string, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if aead == nil || value == "" || isEncrypted(value) {
+		return value, nil
+	}
+	return encrypt(value)
+}
+
+// OpenString decrypts a value sealed by SealString; other values are returned unchanged
+func OpenString(value string) (string, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if !isEncrypted(value) {
+		return value, nil
+	}
+
+	decrypted, err := decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	s, ok := decrypted.(string)
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	return s, nil
+}
+
+// Reseal returns a stored extra config updated after the secret paths changed:
+// values at secret paths are encrypted, encrypted values at other paths are
+// decrypted. Values that stayed secret are kept as they are.
+func Reseal(config map[string]interface{}) (map[string]interface{}, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	unsealMap("", config)
+	return sealMap("", config)
+}
+
+// unsealMap decrypts the encrypted values of a JSON object that are not at secret paths (mu held)
+func unsealMap(prefix string, object map[string]interface{}) {
+	for key, value := range object {
+		path := joinPath(prefix, key)
+		if isSecret(path) {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			if !isEncrypted(v) {
+				continue
+			}
+			decrypted, err := decrypt(v)
+			if err != nil {
+				log.Printf("Secret %s not decrypted: %v", path, err)
+				continue
+			}
+			object[key] = decrypted
+			if child, ok := decrypted.(map[string]interface{}); ok {
+				unsealMap(path, child)
+			}
+		case map[string]interface{}:
+			unsealMap(path, v)
+		}
+	}
+}
+
+// Open decrypts all encrypted values of a freshly decoded extra config in place
+// Values that cannot be decrypted (no or wrong key) are left encrypted; they
+// are redacted in responses and stored back unchanged.
+func Open(config map[string]interface{}) {
+	mu.RLock()
+	defer mu.RUnlock()
+	openMap("", config)
+}
+
+// openMap decrypts the encrypted values of a JSON object (mu held)
+func openMap(prefix string, object map[string]interface{}) {
+	for key, value := range object {
+		path := joinPath(prefix, key)
+		switch v := value.(type) {
+		case string:
+			if !isEncrypted(v) {
+				continue
+			}
+			decrypted, err := decrypt(v)
+			if err != nil {
+				log.Printf("Secret %s not decrypted: %v", path, err)
+				continue
+			}
+			object[key] = decrypted
+		case map[string]interface{}:
+			openMap(path, v)
+		}
+	}
+}
+
+// Redact returns a copy of a config (extra config blocks at the top level) with
+// the values at secret paths, and values that could not be decrypted, replaced by Redacted
+func Redact(config map[string]interface{}) map[string]interface{} {
+	if config == nil {
+		return nil
+	}
+
+	result := make(map[string]interface{}, len(config))
+	for key, value := range config {
+		result[key] = RedactValue(key, value)
+	}
+	return result
+}
+
+// RedactValue redacts a config value found at a dotted path
+func RedactValue(path string, value interface{}) interface{} {
+	mu.RLock()
+	defer mu.RUnlock()
+	return redactValue(path, value)
+}
+
+// redactValue is RedactValue with mu held
+func redactValue(path string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if isSecret(path) || isEncrypted(value) {
+		return Redacted
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	result := make(map[string]interface{}, len(object))
+	for key, child := range object {
+		result[key] = redactValue(joinPath(path, key), child)
+	}
+	return result
+}
+
+// Restore returns a copy of an extra config in which secret fields that were
+// written as Redacted (e.g. a config read from the API and sent back unchanged)
+// have their previous values again
+func Restore(config, previous map[string]interface{}) map[string]interface{} {
+	restored, _ := RestoreValue("", config, previous).(map[string]interface{})
+	return restored
+}
+
+// RestoreValue is Restore for the value at a dotted path ("" for a whole extra config)
+func RestoreValue(path string, value, previous interface{}) interface{} {
+	mu.RLock()
+	defer mu.RUnlock()
+	return restoreValue(path, value, previous)
+}
+
+// restoreValue is RestoreValue with mu held
+func restoreValue(path string, value, previous interface{}) interface{} {
+	if value == Redacted && isSecret(path) {
+		return previous
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	previousObject, _ := previous.(map[string]interface{})
+
+	result := make(map[string]interface{}, len(object))
+	for key, child := range object {
+		childPath := joinPath(path, key)
+		old, existed := previousObject[key]
+		if child == Redacted && isSecret(childPath) && !existed {
+			continue // Nothing to keep
+		}
+		result[key] = restoreValue(childPath, child, old)
+	}
+	return result
+}
+
+// encrypt encrypts the JSON encoding of a value, so that any JSON type round-trips (mu held)
+func encrypt(value interface{}) (string, error) {
+	if aead == nil {
+		return "", ErrNoKey
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt decrypts a value encrypted by encrypt (mu held)
+func decrypt(value string) (interface{}, error) {
+	if aead == nil {
+		return nil, ErrNoKey
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed encrypted value")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key or corrupted value")
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(plaintext, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// isEncrypted reports whether a value is an encrypted secret
+func isEncrypted(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, encryptedPrefix)
+}
+
+// joinPath appends a key to a dotted path
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
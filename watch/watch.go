@@ -0,0 +1,92 @@
+package watch
+
+import "sync"
+
+// hub hands out one channel per watched device; the channel is closed (and
+// replaced by a new one) when the device changes, waking every watcher at once
+type hub struct {
+	mu       sync.Mutex
+	channels map[string]*entry
+}
+
+// entry is the change channel of a device and the number of watchers holding it
+type entry struct {
+	ch   chan struct{}
+	refs int
+}
+
+var defaultHub = &hub{channels: make(map[string]*entry)}
+
+// Watcher waits for changes of a single device
+// It must be closed when the caller stops waiting, so that devices nobody
+// watches (or that do not exist) are not kept in the hub.
+type Watcher struct {
+	deviceID string
+	entry    *entry
+}
+
+// Watch starts watching a device
+// Watchers must be created before reading the current config, so that a
+// change between the read and the wait is not missed.
+func Watch(deviceID string) *Watcher {
+	w := &Watcher{deviceID: deviceID}
+	w.acquire()
+	return w
+}
+
+// Changed returns a channel that is closed on the next Notify for the device
+func (w *Watcher) Changed() <-chan struct{} {
+	return w.entry.ch
+}
+
+// Rearm starts waiting for the next change after Changed was closed
+// Like Watch, call it before reading the config again.
+func (w *Watcher) Rearm() {
+	w.release()
+	w.acquire()
+}
+
+// Close stops watching the device
+func (w *Watcher) Close() {
+	w.release()
+}
+
+func (w *Watcher) acquire() {
+	defaultHub.mu.Lock()
+	defer defaultHub.mu.Unlock()
+
+	e, ok := defaultHub.channels[w.deviceID]
+	if !ok {
+		e = &entry{ch: make(chan struct{})}
+		defaultHub.channels[w.deviceID] = e
+	}
+	e.refs++
+	w.entry = e
+}
+
+func (w *Watcher) release() {
+	defaultHub.mu.Lock()
+	defer defaultHub.mu.Unlock()
+
+	if w.entry == nil {
+		return
+	}
+	w.entry.refs--
+	// After a Notify the entry is already gone (or replaced by a newer one)
+	if w.entry.refs == 0 && defaultHub.channels[w.deviceID] == w.entry {
+		delete(defaultHub.channels, w.deviceID)
+	}
+	w.entry = nil
+}
+
+// Notify wakes all watchers of a device
+// Devices without watchers cost nothing
+func Notify(deviceID string) {
+	defaultHub.mu.Lock()
+	defer defaultHub.mu.Unlock()
+
+	if e, ok := defaultHub.channels[deviceID]; ok {
+		close(e.ch)
+		delete(defaultHub.channels, deviceID)
+	}
+}